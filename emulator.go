@@ -0,0 +1,78 @@
+package firego
+
+import (
+	"net"
+	_url "net/url"
+	"os"
+	"strings"
+)
+
+// EmulatorHostEnv is the environment variable that, when set to the
+// host and port of a Realtime Database emulator, points every new
+// Firebase reference at the emulator instead of the cloud, the same
+// way the official SDKs do.
+const EmulatorHostEnv = "FIREBASE_DATABASE_EMULATOR_HOST"
+
+// nsParam is the query parameter naming the database a request
+// is meant for, which the emulator needs since it serves many.
+const nsParam = "ns"
+
+// WithNamespace sets the namespace, the name of the database, that is
+// sent along with every request. It is only needed when talking to an
+// emulator and defaults to the subdomain of the database URL when
+// EmulatorHostEnv is set.
+func WithNamespace(ns string) Option {
+	return func(fb *Firebase) {
+		fb.paramsMtx.Lock()
+		fb.params.Set(nsParam, ns)
+		fb.paramsMtx.Unlock()
+	}
+}
+
+// setURL points the reference at url. Parameters in its query string,
+// such as the namespace, are added to the ones of the reference and
+// the host is replaced by the emulator's when EmulatorHostEnv is set.
+func (fb *Firebase) setURL(url string) {
+	url = sanitizeURL(url)
+
+	fb.paramsMtx.Lock()
+	defer fb.paramsMtx.Unlock()
+
+	if i := strings.IndexByte(url, '?'); i >= 0 {
+		query, _ := _url.ParseQuery(url[i+1:])
+		for k, v := range query {
+			fb.params[k] = v
+		}
+		url = strings.TrimSuffix(url[:i], "/")
+	}
+
+	host := os.Getenv(EmulatorHostEnv)
+	if host == "" {
+		fb.url = url
+		return
+	}
+
+	u, err := _url.Parse(url)
+	if err != nil {
+		fb.url = url
+		return
+	}
+	if fb.params.Get(nsParam) == "" {
+		fb.params.Set(nsParam, strings.SplitN(u.Hostname(), ".", 2)[0])
+	}
+	u.Scheme, u.Host = "http", host
+	fb.url = u.String()
+}
+
+// isLoopback reports whether the given host, which may include
+// a port, refers to the local machine.
+func isLoopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
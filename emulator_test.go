@@ -0,0 +1,86 @@
+package firego
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestSanitizeURLLoopback(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"localhost:9000":          "http://localhost:9000",
+		"localhost:9000/?ns=foo":  "http://localhost:9000/?ns=foo",
+		"127.0.0.1:9000/foo":      "http://127.0.0.1:9000/foo",
+		"[::1]:9000":              "http://[::1]:9000",
+		"https://localhost:9000":  "https://localhost:9000",
+		"foo.firebaseio.com/bar/": "https://foo.firebaseio.com/bar",
+	}
+	for url, expected := range tests {
+		assert.Equal(t, expected, sanitizeURL(url), url)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	one := New(server.URL+"/?ns=one", nil)
+	assert.Equal(t, server.URL, one.URL())
+	two := NewWithOptions(server.URL, WithNamespace("two"))
+
+	require.NoError(t, one.Child("foo").Set("one"))
+	require.NoError(t, two.Child("foo").Set("two"))
+
+	// references created from the namespaced ones stay in it
+	ref, err := one.Ref("foo")
+	require.NoError(t, err)
+	var v string
+	require.NoError(t, ref.Value(&v))
+	assert.Equal(t, "one", v)
+	require.NoError(t, two.Child("foo").Value(&v))
+	assert.Equal(t, "two", v)
+	assert.Nil(t, server.Get("foo"))
+
+	// so do the connections watching them
+	notifications := make(chan Event)
+	require.NoError(t, ref.Watch(notifications))
+	defer ref.StopWatching()
+	select {
+	case e := <-notifications:
+		assert.Equal(t, "one", e.Data)
+	case <-time.After(time.Second):
+		t.Fatal("did not receive the initial event")
+	}
+}
+
+func TestEmulatorHostEnv(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	require.NoError(t, os.Setenv(EmulatorHostEnv, host))
+	defer os.Unsetenv(EmulatorHostEnv)
+
+	fb := New("https://my-db.firebaseio.com/foo", nil)
+	assert.Equal(t, server.URL+"/foo", fb.URL())
+	require.NoError(t, fb.Set("bar"))
+
+	emulated := New(server.URL+"?ns=my-db", nil)
+	var v string
+	require.NoError(t, emulated.Child("foo").Value(&v))
+	assert.Equal(t, "bar", v)
+	assert.Nil(t, server.Get("foo"))
+
+	// an explicit namespace takes precedence
+	fb = NewWithOptions("https://my-db.firebaseio.com", WithNamespace("other"))
+	assert.Equal(t, server.URL+"/.json?ns=other", fb.String())
+}
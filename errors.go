@@ -0,0 +1,136 @@
+package firego
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrPermissionDenied matches errors returned when the request
+	// is not authorized to access the location.
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrPreconditionFailed matches errors returned when the ETag sent
+	// with a conditional request does not match the data at the location.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrRateLimited matches errors returned when too many requests
+	// are being made to Firebase.
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// Error is returned when Firebase responds to a request with
+// a non successful status code.
+type Error struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Message is the error message sent by Firebase.
+	Message string
+	// Method is the HTTP method of the failed request.
+	Method string
+	// Path is the path of the failed request.
+	Path string
+}
+
+func newError(req *http.Request, resp *http.Response, body []byte) *Error {
+	var payload struct {
+		Error string `json:"error"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if err := json.Unmarshal(body, &payload); err == nil && payload.Error != "" {
+		msg = payload.Error
+	}
+
+	return &Error{
+		StatusCode: resp.StatusCode,
+		Message:    msg,
+		Method:     req.Method,
+		Path:       req.URL.Path,
+	}
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	return fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, msg)
+}
+
+// Is reports whether the error matches one of ErrPermissionDenied,
+// ErrPreconditionFailed or ErrRateLimited.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrPermissionDenied:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// IsPermissionDenied reports whether err was caused by Firebase
+// rejecting the credentials or rules for a request.
+func IsPermissionDenied(err error) bool {
+	return errors.Is(err, ErrPermissionDenied)
+}
+
+// IsPreconditionFailed reports whether err was caused by a
+// conditional request whose ETag no longer matched.
+func IsPreconditionFailed(err error) bool {
+	return errors.Is(err, ErrPreconditionFailed)
+}
+
+// IsRateLimited reports whether err was caused by Firebase
+// throttling requests.
+func IsRateLimited(err error) bool {
+	return errors.Is(err, ErrRateLimited)
+}
+
+// PreconditionFailedError is returned when a conditional write is rejected
+// because the data at the location changed since its ETag was obtained.
+type PreconditionFailedError struct {
+	// Err is the underlying response error.
+	Err *Error
+	// ETag is the current ETag of the location.
+	ETag string
+
+	value []byte
+}
+
+func (e *PreconditionFailedError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying response error.
+func (e *PreconditionFailedError) Unwrap() error {
+	return e.Err
+}
+
+// Value unmarshals the current data of the location, which was sent
+// back by Firebase when rejecting the write, into v.
+func (e *PreconditionFailedError) Value(v interface{}) error {
+	return json.Unmarshal(e.value, v)
+}
+
+// responseError builds the error returned for a response with a non
+// successful status code.
+func responseError(req *http.Request, resp *http.Response, body []byte) error {
+	err := newError(req, resp, body)
+	etag := resp.Header.Get(etagHeader)
+	if resp.StatusCode != http.StatusPreconditionFailed || etag == "" {
+		return err
+	}
+
+	// the body holds the current value rather than a message
+	err.Message = ""
+
+	return &PreconditionFailedError{
+		Err:   err,
+		ETag:  etag,
+		value: body,
+	}
+}
@@ -0,0 +1,75 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	var status int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"error": %q}`, http.StatusText(status))
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("foo")
+	testCases := []struct {
+		status             int
+		permissionDenied   bool
+		preconditionFailed bool
+		rateLimited        bool
+	}{
+		{status: http.StatusUnauthorized, permissionDenied: true},
+		{status: http.StatusForbidden, permissionDenied: true},
+		{status: http.StatusPreconditionFailed, preconditionFailed: true},
+		{status: http.StatusTooManyRequests, rateLimited: true},
+		{status: http.StatusNotFound},
+		{status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range testCases {
+		status = tt.status
+		_, err := fb.Push(true)
+		require.Error(t, err, "status %d", tt.status)
+
+		var fErr *Error
+		require.True(t, errors.As(err, &fErr), "status %d", tt.status)
+		assert.Equal(t, tt.status, fErr.StatusCode)
+		assert.Equal(t, http.StatusText(tt.status), fErr.Message)
+		assert.Equal(t, "POST", fErr.Method)
+		assert.Equal(t, "/foo/.json", fErr.Path)
+
+		assert.Equal(t, tt.permissionDenied, IsPermissionDenied(err), "status %d", tt.status)
+		assert.Equal(t, tt.preconditionFailed, IsPreconditionFailed(err), "status %d", tt.status)
+		assert.Equal(t, tt.rateLimited, IsRateLimited(err), "status %d", tt.status)
+	}
+}
+
+func TestErrorWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.RequireAuth(true)
+	fb := New(server.URL, nil)
+
+	err := fb.Watch(make(chan Event))
+	require.Error(t, err)
+	assert.True(t, IsPermissionDenied(err))
+
+	var fErr *Error
+	require.True(t, errors.As(err, &fErr))
+	assert.Equal(t, "Could not parse auth token.", fErr.Message)
+	assert.Equal(t, "GET", fErr.Method)
+}
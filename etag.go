@@ -0,0 +1,72 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// header constants used for conditional requests
+const (
+	etagHeader        = "ETag"
+	requestETagHeader = "X-Firebase-ETag"
+	ifMatchHeader     = "if-match"
+)
+
+// ValueWithETag gets the value of the Firebase reference along with
+// the ETag identifying it, which can be handed to SetIfMatch and
+// RemoveIfMatch.
+//
+// Reference https://firebase.google.com/docs/database/rest/app-management#conditional-requests
+func (fb *Firebase) ValueWithETag(v interface{}) (string, error) {
+	return fb.ValueWithETagContext(context.Background(), v)
+}
+
+// ValueWithETagContext is like ValueWithETag but the request is bound
+// to the given context.
+func (fb *Firebase) ValueWithETagContext(ctx context.Context, v interface{}) (string, error) {
+	headers, bytes, err := fb.doRequest(ctx, "GET", nil, withHeader(requestETagHeader, "true"))
+	if err != nil {
+		return "", err
+	}
+
+	etag := headers.Get(etagHeader)
+	if etag == "" {
+		return "", errors.New("no etag returned by Firebase")
+	}
+	return etag, json.Unmarshal(bytes, v)
+}
+
+// SetIfMatch sets the value of the Firebase reference only if the data
+// at the location still matches the given ETag. Otherwise a
+// *PreconditionFailedError holding the current ETag and value
+// of the location is returned.
+func (fb *Firebase) SetIfMatch(v interface{}, etag string) error {
+	return fb.SetIfMatchContext(context.Background(), v, etag)
+}
+
+// SetIfMatchContext is like SetIfMatch but the request is bound
+// to the given context.
+func (fb *Firebase) SetIfMatchContext(ctx context.Context, v interface{}, etag string) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, _, err = fb.doRequest(ctx, "PUT", bytes, withHeader(ifMatchHeader, etag))
+	return err
+}
+
+// RemoveIfMatch removes the Firebase reference from the cloud only if
+// the data at the location still matches the given ETag. Otherwise a
+// *PreconditionFailedError holding the current ETag and value of the
+// location is returned.
+func (fb *Firebase) RemoveIfMatch(etag string) error {
+	return fb.RemoveIfMatchContext(context.Background(), etag)
+}
+
+// RemoveIfMatchContext is like RemoveIfMatch but the request is bound
+// to the given context.
+func (fb *Firebase) RemoveIfMatchContext(ctx context.Context, etag string) error {
+	_, _, err := fb.doRequest(ctx, "DELETE", nil, withHeader(ifMatchHeader, etag))
+	return err
+}
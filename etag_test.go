@@ -0,0 +1,66 @@
+package firego
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestSetIfMatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("counter", 1)
+
+	fb := New(server.URL+"/counter", nil)
+	var v int
+	etag, err := fb.ValueWithETag(&v)
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+	assert.NotEmpty(t, etag)
+
+	// someone else writes in the meantime
+	server.Set("counter", 5)
+
+	err = fb.SetIfMatch(v+1, etag)
+	require.Error(t, err)
+	assert.True(t, IsPreconditionFailed(err))
+
+	var pfErr *PreconditionFailedError
+	require.True(t, errors.As(err, &pfErr))
+	assert.NotEqual(t, etag, pfErr.ETag)
+	require.NoError(t, pfErr.Value(&v))
+	assert.Equal(t, 5, v)
+	assert.EqualValues(t, 5, server.Get("counter"))
+
+	// retry with the values returned by the rejection
+	require.NoError(t, fb.SetIfMatch(v+1, pfErr.ETag))
+	assert.EqualValues(t, 6, server.Get("counter"))
+}
+
+func TestRemoveIfMatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "bar")
+
+	fb := New(server.URL+"/foo", nil)
+	var v string
+	etag, err := fb.ValueWithETag(&v)
+	require.NoError(t, err)
+
+	server.Set("foo", "baz")
+	err = fb.RemoveIfMatch(etag)
+	assert.True(t, IsPreconditionFailed(err))
+	assert.Equal(t, "baz", server.Get("foo"))
+
+	etag, err = fb.ValueWithETag(&v)
+	require.NoError(t, err)
+	require.NoError(t, fb.RemoveIfMatch(etag))
+	assert.Nil(t, server.Get("foo"))
+}
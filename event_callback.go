@@ -1,8 +1,9 @@
 package firego
 
 import (
-	"errors"
+	"context"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
@@ -10,291 +11,426 @@ import (
 	"github.com/zabawaba99/firego/sync"
 )
 
-// ChildEventFunc is the type of function that is called for every
-// new child added under a firebase reference. The snapshot argument
-// contains the data that was added. The previousChildKey argument
-// contains the key of the previous child that this function was called for.
+// ChildEventFunc is the type of function that is called for the children
+// of a firebase reference. The snapshot argument contains the data of the
+// child. The previousChildKey argument contains the key of the sibling that
+// comes before the child in the order of the reference's query, or an empty
+// string if it comes first.
 type ChildEventFunc func(snapshot DataSnapshot, previousChildKey string)
 
+// kinds of child events
+const (
+	childAddedEvent   = "child_added"
+	childChangedEvent = "child_changed"
+	childRemovedEvent = "child_removed"
+	childMovedEvent   = "child_moved"
+)
+
 // ChildAdded listens on the firebase instance and executes the callback
-// for every child that is added.
-//
-// You cannot set the same function twice on a Firebase reference, if you do
-// the first function will be overridden and you will not be able to close the
-// connection.
-func (fb *Firebase) ChildAdded(fn ChildEventFunc) error {
-	return fb.addEventFunc(fn, fn.childAdded)
+// for every child that is added. The returned Subscription removes it.
+func (fb *Firebase) ChildAdded(fn ChildEventFunc) (*Subscription, error) {
+	return fb.ChildAddedContext(context.Background(), fn)
 }
 
-func (fn ChildEventFunc) childAdded(db *sync.Database, prevKey *string, notifications chan Event) error {
-	for event := range notifications {
-		if event.Type == EventTypeError {
-			err, ok := event.Data.(error)
-			if !ok {
-				err = fmt.Errorf("Got error from event %#v", event)
-			}
-			return err
-		}
+// ChildAddedContext is like ChildAdded but the listener is removed
+// once the given context is done.
+func (fb *Firebase) ChildAddedContext(ctx context.Context, fn ChildEventFunc) (*Subscription, error) {
+	return fb.addEventFunc(ctx, fn.key(), fb.childEvents(childAddedEvent, fn))
+}
 
-		if event.Type != EventTypePut {
-			continue
-		}
+// ChildChanged listens on the firebase instance and executes the callback
+// for every child that is changed. The returned Subscription removes it.
+func (fb *Firebase) ChildChanged(fn ChildEventFunc) (*Subscription, error) {
+	return fb.ChildChangedContext(context.Background(), fn)
+}
 
-		child := strings.Split(event.Path[1:], "/")[0]
-		if event.Data == nil {
-			db.Del(child)
-			continue
-		}
+// ChildChangedContext is like ChildChanged but the listener is removed
+// once the given context is done.
+func (fb *Firebase) ChildChangedContext(ctx context.Context, fn ChildEventFunc) (*Subscription, error) {
+	return fb.addEventFunc(ctx, fn.key(), fb.childEvents(childChangedEvent, fn))
+}
 
-		if _, ok := db.Get("").Child(child); ok {
-			// if the child isn't being added, forget it
-			continue
-		}
+// ChildRemoved listens on the firebase instance and executes the callback
+// for every child that is deleted. The previousChildKey is always empty.
+// The returned Subscription removes it.
+func (fb *Firebase) ChildRemoved(fn ChildEventFunc) (*Subscription, error) {
+	return fb.ChildRemovedContext(context.Background(), fn)
+}
+
+// ChildRemovedContext is like ChildRemoved but the listener is removed
+// once the given context is done.
+func (fb *Firebase) ChildRemovedContext(ctx context.Context, fn ChildEventFunc) (*Subscription, error) {
+	return fb.addEventFunc(ctx, fn.key(), fb.childEvents(childRemovedEvent, fn))
+}
+
+// ChildMoved listens on the firebase instance and executes the callback
+// for every child whose change affects its position in the order of the
+// reference's query, which is given by OrderBy and defaults to priorities.
+// Children ordered by key never move. The returned Subscription removes it.
+func (fb *Firebase) ChildMoved(fn ChildEventFunc) (*Subscription, error) {
+	return fb.ChildMovedContext(context.Background(), fn)
+}
+
+// ChildMovedContext is like ChildMoved but the listener is removed
+// once the given context is done.
+func (fb *Firebase) ChildMovedContext(ctx context.Context, fn ChildEventFunc) (*Subscription, error) {
+	return fb.addEventFunc(ctx, fn.key(), fb.childEvents(childMovedEvent, fn))
+}
+
+// ValueEventFunc is the type of function that is called with
+// the data of a firebase reference every time it changes.
+type ValueEventFunc func(snapshot DataSnapshot)
+
+// OnValue listens on the firebase instance and executes the callback with
+// a snapshot of all its data, first with the initial data and then every
+// time Firebase reports a change. The returned Subscription removes it.
+func (fb *Firebase) OnValue(fn ValueEventFunc) (*Subscription, error) {
+	return fb.OnValueContext(context.Background(), fn)
+}
 
-		m, ok := event.Data.(map[string]interface{})
-		if child == "" && ok {
-			// if we were given a map at the root then we have
-			// to send an event per child
-			for _, k := range sortedKeys(m) {
-				v := m[k]
-				node := sync.NewNode(k, v)
-				db.Add(k, node)
-				fn(newSnapshot(node), *prevKey)
-				*prevKey = k
+// OnValueContext is like OnValue but the listener is also removed
+// once the given context is done.
+func (fb *Firebase) OnValueContext(ctx context.Context, fn ValueEventFunc) (*Subscription, error) {
+	key := fb.Key()
+	return fb.addEventFunc(ctx, "", func(db *sync.Database, notifications chan Event) error {
+		for event := range notifications {
+			switch event.Type {
+			case EventTypeError:
+				err, ok := event.Data.(error)
+				if !ok {
+					err = fmt.Errorf("Got error from event %#v", event)
+				}
+				return err
+			case EventTypePut, EventTypePatch:
+				event.apply(db)
+				snapshot := newSnapshot(db.Get(""))
+				snapshot.Key = key
+				fn(snapshot)
 			}
-			continue
 		}
+		return nil
+	})
+}
 
-		// we have a single event to process
-		node := sync.NewNode(child, event.Data)
-		db.Add(strings.Trim(child, "/"), node)
+type handleSSEFunc func(*sync.Database, chan Event) error
+
+// childEvents returns a handler that keeps a local copy of the location
+// up to date and calls fn for every child event of the given kind.
+func (fb *Firebase) childEvents(kind string, fn ChildEventFunc) handleSSEFunc {
+	children := &childList{order: fb.ordering()}
+	return func(db *sync.Database, notifications chan Event) error {
+		for event := range notifications {
+			switch event.Type {
+			case EventTypeError:
+				err, ok := event.Data.(error)
+				if !ok {
+					err = fmt.Errorf("Got error from event %#v", event)
+				}
+				return err
+			case EventTypePut, EventTypePatch:
+			default:
+				continue
+			}
 
-		fn(newSnapshot(node), *prevKey)
-		*prevKey = child
+			for _, c := range children.update(db, event) {
+				if c.kind == kind {
+					fn(newSnapshot(c.node), c.previousChildKey)
+				}
+			}
+		}
+		return nil
 	}
-	return nil
 }
 
-// ChildChanged listens on the firebase instance and executes the callback
-// for every child that is changed.
-//
-// You cannot set the same function twice on a Firebase reference, if you do
-// the first function will be overridden and you will not be able to close the
-// connection.
-func (fb *Firebase) ChildChanged(fn ChildEventFunc) error {
-	return fb.addEventFunc(fn, fn.childChanged)
+// childChange is a change to a child of a location.
+type childChange struct {
+	kind             string
+	node             *sync.Node
+	previousChildKey string
+}
+
+// childList holds copies of the children of a location, which are not
+// modified when the local database is, sorted in the order of a query.
+type childList struct {
+	order ordering
+	nodes []*sync.Node
+	byKey map[string]*sync.Node
 }
 
-func (fn ChildEventFunc) childChanged(db *sync.Database, prevKey *string, notifications chan Event) error {
-	first, ok := <-notifications
-	if !ok {
-		return errors.New("channel closed")
+// update applies the event to db and returns the changes it made to
+// the children, only looking at the children the event touches.
+func (l *childList) update(db *sync.Database, event Event) []childChange {
+	keys, all := touchedKeys(event)
+	event.apply(db)
+	root := db.Get("")
+	if all {
+		before := l.nodes
+		l.reset(sortedChildren(root, l.order))
+		return diffChildren(before, l.nodes, l.order)
 	}
 
-	db.Add("", sync.NewNode("", first.Data))
-	for event := range notifications {
-		if event.Type == EventTypeError {
-			err, ok := event.Data.(error)
-			if !ok {
-				err = fmt.Errorf("Got error from event %#v", event)
+	var removed, updated []*sync.Node
+	previous := make(map[string]*sync.Node, len(keys))
+	for _, k := range keys {
+		old := l.byKey[k]
+		var (
+			n    *sync.Node
+			data interface{}
+		)
+		if child, ok := root.Child(k); ok {
+			if data = child.Export(); data != nil {
+				n = sync.NewNode(k, data)
 			}
-			return err
 		}
 
-		path := strings.Trim(event.Path, "/")
-		if event.Data == nil {
-			db.Del(path)
+		switch {
+		case old == nil && n == nil:
+			continue
+		case old != nil && n != nil && reflect.DeepEqual(old.Export(), data):
 			continue
 		}
-
-		child := strings.Split(path, "/")[0]
-		node := sync.NewNode(child, event.Data)
-
-		dbNode := db.Get("")
-		if _, ok := dbNode.Child(child); child != "" && !ok {
-			// if the child is new, ignore it.
-			db.Add(path, node)
+		if old != nil {
+			l.remove(old)
+			previous[k] = old
+		}
+		if n == nil {
+			removed = append(removed, old)
 			continue
 		}
+		l.insert(n)
+		updated = append(updated, n)
+	}
 
-		if m, ok := event.Data.(map[string]interface{}); child == "" && ok {
-			// we've got children so send an event per child
-			for _, k := range sortedKeys(m) {
-				v := m[k]
-				node := sync.NewNode(k, v)
-				newPath := strings.TrimPrefix(child+"/"+k, "/")
-				if _, ok := dbNode.Child(k); !ok {
-					db.Add(newPath, node)
-					continue
-				}
+	var changes []childChange
+	l.sort(removed)
+	for _, n := range removed {
+		changes = append(changes, childChange{kind: childRemovedEvent, node: n})
+	}
+	l.sort(updated)
+	for _, n := range updated {
+		var prevKey string
+		if i := l.index(n); i > 0 {
+			prevKey = l.nodes[i-1].Key
+		}
 
-				db.Update(newPath, node)
-				fn(newSnapshot(node), *prevKey)
-				*prevKey = k
-			}
+		old, ok := previous[n.Key]
+		if !ok {
+			changes = append(changes, childChange{kind: childAddedEvent, node: n, previousChildKey: prevKey})
 			continue
 		}
+		changes = append(changes, childChange{kind: childChangedEvent, node: n, previousChildKey: prevKey})
+		if !reflect.DeepEqual(l.order.value(old), l.order.value(n)) {
+			changes = append(changes, childChange{kind: childMovedEvent, node: n, previousChildKey: prevKey})
+		}
+	}
+	return changes
+}
 
-		db.Update(path, node)
-		fn(newSnapshot(db.Get(child)), *prevKey)
-		*prevKey = child
+func (l *childList) reset(nodes []*sync.Node) {
+	l.nodes = nodes
+	l.byKey = make(map[string]*sync.Node, len(nodes))
+	for _, n := range nodes {
+		l.byKey[n.Key] = n
 	}
-	return nil
 }
 
-// ChildRemoved listens on the firebase instance and executes the callback
-// for every child that is deleted.
-//
-// You cannot set the same function twice on a Firebase reference, if you do
-// the first function will be overridden and you will not be able to close the
-// connection.
-func (fb *Firebase) ChildRemoved(fn ChildEventFunc) error {
-	return fb.addEventFunc(fn, fn.childRemoved)
+// index returns the position n has, or would have, in the list.
+func (l *childList) index(n *sync.Node) int {
+	return sort.Search(len(l.nodes), func(i int) bool {
+		return l.order.compare(l.nodes[i], n) >= 0
+	})
 }
 
-func (fn ChildEventFunc) childRemoved(db *sync.Database, prevKey *string, notifications chan Event) error {
-	first, ok := <-notifications
-	if !ok {
-		return errors.New("channel closed")
+func (l *childList) insert(n *sync.Node) {
+	if l.byKey == nil {
+		l.byKey = map[string]*sync.Node{}
 	}
+	i := l.index(n)
+	l.nodes = append(l.nodes, nil)
+	copy(l.nodes[i+1:], l.nodes[i:])
+	l.nodes[i] = n
+	l.byKey[n.Key] = n
+}
 
-	node := sync.NewNode("", first.Data)
-	db.Add("", node)
+func (l *childList) remove(n *sync.Node) {
+	i := l.index(n)
+	l.nodes = append(l.nodes[:i], l.nodes[i+1:]...)
+	delete(l.byKey, n.Key)
+}
 
-	for event := range notifications {
-		if event.Type == EventTypeError {
-			err, ok := event.Data.(error)
-			if !ok {
-				err = fmt.Errorf("Got error from event %#v", event)
-			}
-			return err
-		}
+func (l *childList) sort(nodes []*sync.Node) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return l.order.compare(nodes[i], nodes[j]) < 0
+	})
+}
 
-		path := strings.Trim(event.Path, "/")
-		node := sync.NewNode(path, event.Data)
+// touchedKeys returns the keys of the children of the location that
+// the event may change, or all when it replaces the whole location.
+func touchedKeys(event Event) (keys []string, all bool) {
+	path := strings.Trim(event.Path, "/")
+	if path == "" && event.Type == EventTypePut {
+		return nil, true
+	}
 
-		if event.Type == EventTypePatch {
-			db.Update(path, node)
-			continue
+	var paths []string
+	if path != "" {
+		paths = []string{path}
+	} else {
+		children, _ := event.Data.(map[string]interface{})
+		for k := range children {
+			paths = append(paths, strings.Trim(k, "/"))
 		}
+	}
 
-		if event.Data != nil {
-			db.Add(path, node)
+	seen := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		key := strings.SplitN(p, "/", 2)[0]
+		if key == "" || key == priorityKey || key == valueKey || seen[key] {
+			// the priority of the location is not a child
 			continue
 		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	return keys, false
+}
 
-		if path == "" {
-			// if node that is being listened to is deleted,
-			// an event should be triggered for every child
-			children := db.Get("").Children
-			orderedChildren := make([]string, len(children))
-			var i int
-			for k := range children {
-				orderedChildren[i] = k
-				i++
-			}
+// sortedChildren returns copies of the children of n sorted in the
+// given order.
+func sortedChildren(n *sync.Node, order ordering) []*sync.Node {
+	children := make([]*sync.Node, 0, len(n.Children))
+	for k, child := range n.Children {
+		if data := child.Export(); data != nil {
+			children = append(children, sync.NewNode(k, data))
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return order.compare(children[i], children[j]) < 0
+	})
+	return children
+}
 
-			sort.Strings(orderedChildren)
+// diffChildren computes the changes that turned the children
+// before into the ones after, both sorted in the given order.
+func diffChildren(before, after []*sync.Node, order ordering) []childChange {
+	var changes []childChange
 
-			for _, k := range orderedChildren {
-				node := db.Get(k)
-				fn(newSnapshot(node), "")
-				db.Del(k)
-			}
+	previous := make(map[string]*sync.Node, len(before))
+	for _, n := range before {
+		previous[n.Key] = n
+	}
+	current := make(map[string]bool, len(after))
+	for _, n := range after {
+		current[n.Key] = true
+	}
 
-			db.Del(path)
-			continue
+	for _, n := range before {
+		if !current[n.Key] {
+			changes = append(changes, childChange{kind: childRemovedEvent, node: n})
 		}
-
-		node = db.Get(path)
-		fn(newSnapshot(node), "")
-		db.Del(path)
 	}
-	return nil
-}
-
-type handleSSEFunc func(*sync.Database, *string, chan Event) error
 
-func (fb *Firebase) addEventFunc(fn ChildEventFunc, handleSSE handleSSEFunc) error {
-	fb.eventMtx.Lock()
-	defer fb.eventMtx.Unlock()
+	for i, n := range after {
+		var prevKey string
+		if i > 0 {
+			prevKey = after[i-1].Key
+		}
 
-	stop := make(chan struct{})
-	key := fmt.Sprintf("%v", fn)
-	if _, ok := fb.eventFuncs[key]; ok {
-		return nil
+		old, ok := previous[n.Key]
+		switch {
+		case !ok:
+			changes = append(changes, childChange{kind: childAddedEvent, node: n, previousChildKey: prevKey})
+		case !reflect.DeepEqual(old.Export(), n.Export()):
+			changes = append(changes, childChange{kind: childChangedEvent, node: n, previousChildKey: prevKey})
+			if !reflect.DeepEqual(order.value(old), order.value(n)) {
+				changes = append(changes, childChange{kind: childMovedEvent, node: n, previousChildKey: prevKey})
+			}
+		}
 	}
+	return changes
+}
 
-	fb.eventFuncs[key] = stop
-	notifications, err := fb.watch(stop)
+// key identifies the function among the ones set on a reference.
+func (fn ChildEventFunc) key() string {
+	return fmt.Sprintf("%v", fn)
+}
+
+// addEventFunc sets a listener that hands the events of the location to
+// handleSSE. The key identifies the function of the listener, if any,
+// for RemoveEventFunc.
+func (fb *Firebase) addEventFunc(ctx context.Context, key string, handleSSE handleSSEFunc) (*Subscription, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	notifications, err := fb.watch(ctx)
 	if err != nil {
-		return err
+		cancel()
+		return nil, err
 	}
 
-	db := sync.NewDB()
-	prevKey := new(string)
-	var run func(notifications chan Event, backoff time.Duration)
-	run = func(notifications chan Event, backoff time.Duration) {
+	sub := newSubscription(cancel)
+	fb.eventMtx.Lock()
+	fb.eventFuncs[sub] = key
+	fb.eventMtx.Unlock()
+
+	go func() {
+		err := fb.listen(ctx, notifications, handleSSE)
+		cancel()
 		fb.eventMtx.Lock()
-		if _, ok := fb.eventFuncs[key]; !ok {
-			fb.eventMtx.Unlock()
-			// the func has been removed
-			return
-		}
+		delete(fb.eventFuncs, sub)
 		fb.eventMtx.Unlock()
+		sub.finish(err)
+	}()
+	return sub, nil
+}
 
-		if err := handleSSE(db, prevKey, notifications); err == nil {
-			// we returned gracefully
-			return
-		}
-
-		// give firebase some time
-		backoff *= 2
-		time.Sleep(backoff)
-
-		// try and reconnect
-		for notifications, err = fb.watch(stop); err != nil; time.Sleep(backoff) {
-			fb.eventMtx.Lock()
-			if _, ok := fb.eventFuncs[key]; !ok {
-				fb.eventMtx.Unlock()
-				// func has been removed
-				return
+// listen hands the events to handleSSE, reconnecting whenever the
+// connection is lost, and returns the error that ended the listener.
+func (fb *Firebase) listen(ctx context.Context, notifications chan Event, handleSSE handleSSEFunc) error {
+	db := sync.NewDB()
+	policy := fb.listenerPolicy()
+	for {
+		handleSSE(db, notifications)
+
+		var err error
+		for attempt := 1; ; attempt++ {
+			if !sleepContext(ctx, policy.backoff(attempt)) {
+				return requestError(ctx, ctx.Err())
+			}
+			if notifications, err = fb.watch(ctx); err == nil {
+				break
+			}
+			if rejected(err) {
+				return err
 			}
-			fb.eventMtx.Unlock()
 		}
-
-		// give this another shot
-		run(notifications, backoff)
 	}
+}
 
-	go run(notifications, fb.watchHeartbeat)
-	return nil
+// sleepContext pauses for the given duration and reports whether
+// the context was still alive when the duration elapsed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
 }
 
-// RemoveEventFunc removes the given function from the firebase
-// reference.
+// RemoveEventFunc removes the listeners that were set with
+// the given function from the firebase reference.
+//
+// Deprecated: functions cannot be told apart reliably, closures created
+// by the same code are considered equal, use the Cancel method of the
+// Subscription returned when setting the listener instead.
 func (fb *Firebase) RemoveEventFunc(fn ChildEventFunc) {
 	fb.eventMtx.Lock()
 	defer fb.eventMtx.Unlock()
 
-	key := fmt.Sprintf("%v", fn)
-	stop, ok := fb.eventFuncs[key]
-	if !ok {
-		return
-	}
-
-	delete(fb.eventFuncs, key)
-	close(stop)
-}
-
-func sortedKeys(m map[string]interface{}) []string {
-	orderedKeys := make([]string, len(m))
-	var i int
-	for k := range m {
-		orderedKeys[i] = k
-		i++
+	key := fn.key()
+	for sub, k := range fb.eventFuncs {
+		if k == key {
+			delete(fb.eventFuncs, sub)
+			sub.Cancel()
+		}
 	}
-
-	sort.Strings(orderedKeys)
-	return orderedKeys
 }
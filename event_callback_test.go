@@ -1,6 +1,7 @@
 package firego
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -71,6 +72,7 @@ func TestChildAddedReconnect(t *testing.T) {
 
 	fb = New(server.URL, nil)
 	fb.watchHeartbeat = 50 * time.Millisecond
+	fb.SetReconnectPolicy(&ReconnectPolicy{InitialBackoff: 10 * time.Millisecond})
 
 	addNotifications := make(chan Event)
 	// use this to sync up between different events
@@ -82,7 +84,7 @@ func TestChildAddedReconnect(t *testing.T) {
 		addNotifications <- Event{Path: snapshot.Key}
 		mtx.Unlock()
 	}
-	err := fb.ChildAdded(fn)
+	_, err := fb.ChildAdded(fn)
 	require.NoError(t, err)
 
 	readNotification(t, addNotifications)
@@ -90,7 +92,7 @@ func TestChildAddedReconnect(t *testing.T) {
 
 	expected := []testEvent{
 		{newSnapshot(sync.NewNode("hello", "world")), ""},
-		{newSnapshot(sync.NewNode("goodbye", "world")), "hello"},
+		{newSnapshot(sync.NewNode("goodbye", "world")), ""},
 	}
 
 	mtx.Lock()
@@ -130,7 +132,7 @@ func TestChildAdded(t *testing.T) {
 		addNotifications <- Event{Path: snapshot.Key}
 		mtx.Unlock()
 	}
-	err = fb.ChildAdded(fn)
+	_, err = fb.ChildAdded(fn)
 	require.NoError(t, err)
 
 	// read the two events that are already there
@@ -162,7 +164,7 @@ func TestChildAdded(t *testing.T) {
 	readNotification(t, addNotifications)
 
 	// should not get updates
-	err = fb.Child("foo").Set(false)
+	err = fb.Child("lala").Set(false)
 	require.NoError(t, err)
 	readNotification(t, allNotifications)
 
@@ -185,12 +187,12 @@ func TestChildAdded(t *testing.T) {
 	expected := []testEvent{
 		{newSnapshot(sync.NewNode("AAA", "foo")), ""},
 		{newSnapshot(sync.NewNode("something", true)), "AAA"},
-		{newSnapshot(sync.NewNode("foo", float64(2))), "something"},
-		{newSnapshot(sync.NewNode("alal", "aaf")), "foo"},
+		{newSnapshot(sync.NewNode("foo", float64(2))), "AAA"},
+		{newSnapshot(sync.NewNode("alal", "aaf")), ""},
 		{newSnapshot(sync.NewNode("lala", "faa")), "alal"},
-		{newSnapshot(sync.NewNode("bar", map[string]interface{}{"hi": "mom"})), "lala"},
-		{newSnapshot(sync.NewNode(pushKey, "gaga oh la la")), "bar"},
-		{newSnapshot(sync.NewNode("bar", "something-else")), pushKey},
+		{newSnapshot(sync.NewNode("bar", map[string]interface{}{"hi": "mom"})), "alal"},
+		{newSnapshot(sync.NewNode(pushKey, "gaga oh la la")), ""},
+		{newSnapshot(sync.NewNode("bar", "something-else")), "alal"},
 	}
 
 	mtx.Lock()
@@ -234,7 +236,7 @@ func TestChildChanged(t *testing.T) {
 		changedNotifications <- Event{Path: snapshot.Key}
 		mtx.Unlock()
 	}
-	err = fb.ChildChanged(fn)
+	_, err = fb.ChildChanged(fn)
 	require.NoError(t, err)
 
 	// should get regular update events
@@ -249,10 +251,10 @@ func TestChildChanged(t *testing.T) {
 	readNotification(t, changedNotifications)
 	readNotification(t, changedNotifications)
 
+	// the children that were not set are gone, so bar is added
 	err = fb.Child("bar").Set(map[string]string{"hi": "mom"})
 	require.NoError(t, err)
 	readNotification(t, allNotifications)
-	readNotification(t, changedNotifications)
 
 	// should not get push
 	_, err = fb.Push("gaga oh la la")
@@ -276,11 +278,10 @@ func TestChildChanged(t *testing.T) {
 	readNotification(t, changedNotifications)
 
 	expected := []testEvent{
-		{newSnapshot(sync.NewNode("foo", float64(2))), ""},
-		{newSnapshot(sync.NewNode("alal", "aaf")), "foo"},
+		{newSnapshot(sync.NewNode("foo", float64(2))), "bar"},
+		{newSnapshot(sync.NewNode("alal", "aaf")), ""},
 		{newSnapshot(sync.NewNode("lala", "faa")), "alal"},
-		{newSnapshot(sync.NewNode("bar", map[string]interface{}{"hi": "mom"})), "lala"},
-		{newSnapshot(sync.NewNode("bar", map[string]interface{}{"hi": "mom", "child": true})), "bar"},
+		{newSnapshot(sync.NewNode("bar", map[string]interface{}{"hi": "mom", "child": true})), "alal"},
 	}
 
 	mtx.Lock()
@@ -320,7 +321,7 @@ func TestChildRemoved(t *testing.T) {
 		removedNotifications <- Event{Path: snapshot.Key}
 		mtx.Unlock()
 	}
-	err = fb.ChildRemoved(fn)
+	_, err = fb.ChildRemoved(fn)
 	require.NoError(t, err)
 
 	// should get regular deletion events
@@ -399,7 +400,7 @@ func TestRemoveEventFunc(t *testing.T) {
 	fn := func(snapshot DataSnapshot, previousChildKey string) {
 		assert.Fail(t, "Should not have received anything")
 	}
-	err = fb.ChildAdded(fn)
+	_, err = fb.ChildAdded(fn)
 	require.NoError(t, err)
 
 	fb.RemoveEventFunc(fn)
@@ -407,7 +408,48 @@ func TestRemoveEventFunc(t *testing.T) {
 	fb.Child("hello").Set(false)
 	readNotification(t, allNotifications)
 
+	fb.eventMtx.Lock()
 	assert.Len(t, fb.eventFuncs, 0)
+	fb.eventMtx.Unlock()
+}
+
+func TestChildAddedContext(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	// use this to sync up between different events
+	allNotifications, addNotifications := make(chan Event), make(chan Event, 1)
+	err := fb.Watch(allNotifications)
+	require.NoError(t, err)
+	readNotification(t, allNotifications)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fn := func(snapshot DataSnapshot, previousChildKey string) {
+		addNotifications <- Event{Path: snapshot.Key}
+	}
+	_, err = fb.ChildAddedContext(ctx, fn)
+	require.NoError(t, err)
+
+	fb.Child("hello").Set(false)
+	readNotification(t, allNotifications)
+	readNotification(t, addNotifications)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		fb.eventMtx.Lock()
+		defer fb.eventMtx.Unlock()
+		return len(fb.eventFuncs) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	fb.Child("goodbye").Set(false)
+	readNotification(t, allNotifications)
+	select {
+	case <-addNotifications:
+		assert.Fail(t, "Should not have received anything")
+	case <-time.After(100 * time.Millisecond):
+	}
 }
 
 func readNotification(t *testing.T, notification chan Event) {
@@ -417,3 +459,267 @@ func readNotification(t *testing.T, notification chan Event) {
 		require.FailNow(t, "timed out reading notification")
 	}
 }
+
+func TestChildMoved(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("scores", map[string]interface{}{
+		"alice": map[string]interface{}{"score": 10},
+		"bob":   map[string]interface{}{"score": 20},
+		"carol": map[string]interface{}{"score": 30},
+	})
+	fb := New(server.URL+"/scores", nil).OrderBy("score")
+
+	allNotifications := make(chan Event)
+	require.NoError(t, fb.Watch(allNotifications))
+	readNotification(t, allNotifications)
+
+	var added, changed, moved testEvents
+	notifications := make(chan Event, 10)
+	_, err := fb.ChildAdded(func(snapshot DataSnapshot, previousChildKey string) {
+		added.add(testEvent{snapshot, previousChildKey})
+		notifications <- Event{Path: snapshot.Key}
+	})
+	require.NoError(t, err)
+	_, err = fb.ChildChanged(func(snapshot DataSnapshot, previousChildKey string) {
+		changed.add(testEvent{snapshot, previousChildKey})
+		notifications <- Event{Path: snapshot.Key}
+	})
+	require.NoError(t, err)
+	_, err = fb.ChildMoved(func(snapshot DataSnapshot, previousChildKey string) {
+		moved.add(testEvent{snapshot, previousChildKey})
+		notifications <- Event{Path: snapshot.Key}
+	})
+	require.NoError(t, err)
+
+	// the existing children come in the order of the query
+	for i := 0; i < 3; i++ {
+		readNotification(t, notifications)
+	}
+	require.Equal(t, 3, added.len())
+	assert.Equal(t, "alice", added.get(0).snapshot.Key)
+	assert.Equal(t, "alice", added.get(1).previousKey)
+	assert.Equal(t, "carol", added.get(2).snapshot.Key)
+	assert.Equal(t, "bob", added.get(2).previousKey)
+
+	// alice overtakes everyone, which is both a change and a move
+	require.NoError(t, fb.Child("alice/score").Set(40))
+	readNotification(t, allNotifications)
+	readNotification(t, notifications)
+	readNotification(t, notifications)
+
+	// changes that do not affect the order are not moves
+	require.NoError(t, fb.Child("bob/name").Set("Bob"))
+	readNotification(t, allNotifications)
+	readNotification(t, notifications)
+
+	// new children fit in the order as well
+	require.NoError(t, fb.Child("dave").Set(map[string]interface{}{"score": 25}))
+	readNotification(t, allNotifications)
+	readNotification(t, notifications)
+
+	require.Equal(t, 1, moved.len())
+	assert.Equal(t, "alice", moved.get(0).snapshot.Key)
+	assert.Equal(t, "carol", moved.get(0).previousKey)
+
+	require.Equal(t, 2, changed.len())
+	assert.Equal(t, "alice", changed.get(0).snapshot.Key)
+	assert.Equal(t, "carol", changed.get(0).previousKey)
+	assert.Equal(t, "bob", changed.get(1).snapshot.Key)
+	assert.Equal(t, "", changed.get(1).previousKey)
+
+	require.Equal(t, 4, added.len())
+	assert.Equal(t, "dave", added.get(3).snapshot.Key)
+	assert.Equal(t, "bob", added.get(3).previousKey)
+}
+
+func TestOnValue(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/bob", map[string]interface{}{"name": "Bob", "address": map[string]interface{}{"city": "Paris"}})
+
+	fb := New(server.URL+"/users/bob", nil)
+	snapshots := make(chan DataSnapshot, 10)
+	sub, err := fb.OnValue(func(snapshot DataSnapshot) {
+		snapshots <- snapshot
+	})
+	require.NoError(t, err)
+
+	next := func() DataSnapshot {
+		select {
+		case s := <-snapshots:
+			return s
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for a snapshot")
+		}
+		return DataSnapshot{}
+	}
+
+	s := next()
+	assert.Equal(t, "bob", s.Key)
+	assert.Equal(t, map[string]interface{}{"name": "Bob", "address": map[string]interface{}{"city": "Paris"}}, s.Value)
+
+	// nested puts
+	server.Set("users/bob/address/city", "Lyon")
+	s = next()
+	assert.Equal(t, map[string]interface{}{"name": "Bob", "address": map[string]interface{}{"city": "Lyon"}}, s.Value)
+
+	// nested patches only replace the given children
+	server.Update("users/bob/address", map[string]interface{}{"zip": "69001"})
+	s = next()
+	assert.Equal(t, map[string]interface{}{"name": "Bob", "address": map[string]interface{}{"city": "Lyon", "zip": "69001"}}, s.Value)
+
+	server.Update("users/bob", map[string]interface{}{"name": nil, "age": float64(30)})
+	s = next()
+	assert.Equal(t, map[string]interface{}{"age": float64(30), "address": map[string]interface{}{"city": "Lyon", "zip": "69001"}}, s.Value)
+
+	server.Delete("users/bob")
+	s = next()
+	assert.Nil(t, s.Value)
+
+	sub.Cancel()
+	require.Eventually(t, func() bool {
+		fb.eventMtx.Lock()
+		defer fb.eventMtx.Unlock()
+		return len(fb.eventFuncs) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	server.Set("users/bob", "back")
+	select {
+	case s := <-snapshots:
+		assert.Fail(t, "received a snapshot after canceling", "%#v", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestChildEventsListRemoval(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("list", []interface{}{"a", "b", "c"})
+
+	fb := New(server.URL+"/list", nil)
+	var added, removed testEvents
+	notifications := make(chan Event, 10)
+	sub, err := fb.ChildAdded(func(snapshot DataSnapshot, previousChildKey string) {
+		added.add(testEvent{snapshot, previousChildKey})
+		notifications <- Event{Path: snapshot.Key}
+	})
+	require.NoError(t, err)
+	defer sub.Cancel()
+	sub, err = fb.ChildRemoved(func(snapshot DataSnapshot, previousChildKey string) {
+		removed.add(testEvent{snapshot, previousChildKey})
+		notifications <- Event{Path: snapshot.Key}
+	})
+	require.NoError(t, err)
+	defer sub.Cancel()
+
+	for i := 0; i < 3; i++ {
+		readNotification(t, notifications)
+	}
+
+	require.NoError(t, fb.Child("0").Remove())
+	readNotification(t, notifications)
+	require.Equal(t, 1, removed.len())
+	assert.Equal(t, DataSnapshot{Key: "0", Value: "a"}, removed.get(0).snapshot)
+
+	require.NoError(t, fb.Child("3").Set("d"))
+	readNotification(t, notifications)
+	require.Equal(t, 4, added.len())
+	assert.Equal(t, "3", added.get(3).snapshot.Key)
+	assert.Equal(t, "2", added.get(3).previousKey)
+}
+
+func TestOnValueListRemoval(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("list", []interface{}{"a", "b", "c"})
+
+	fb := New(server.URL+"/list", nil)
+	snapshots := make(chan DataSnapshot, 10)
+	sub, err := fb.OnValue(func(snapshot DataSnapshot) {
+		snapshots <- snapshot
+	})
+	require.NoError(t, err)
+	defer sub.Cancel()
+
+	next := func() DataSnapshot {
+		select {
+		case s := <-snapshots:
+			return s
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for a snapshot")
+		}
+		return DataSnapshot{}
+	}
+	assert.Equal(t, []interface{}{"a", "b", "c"}, next().Value)
+
+	require.NoError(t, fb.Child("0").Remove())
+	assert.Equal(t, []interface{}{nil, "b", "c"}, next().Value)
+
+	require.NoError(t, fb.Child("1").Remove())
+	assert.Equal(t, map[string]interface{}{"2": "c"}, next().Value)
+}
+
+func TestTouchedKeys(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		event Event
+		keys  []string
+		all   bool
+	}{
+		{event: Event{Type: EventTypePut, Path: "/"}, all: true},
+		{event: Event{Type: EventTypePut, Path: "/a/b"}, keys: []string{"a"}},
+		{event: Event{Type: EventTypePatch, Path: "/a"}, keys: []string{"a"}},
+		{event: Event{Type: EventTypePut, Path: "/.priority"}},
+		{
+			event: Event{Type: EventTypePatch, Path: "/", Data: map[string]interface{}{"a/b": 1.0, "a/c": 2.0}},
+			keys:  []string{"a"},
+		},
+	} {
+		keys, all := touchedKeys(test.event)
+		assert.Equal(t, test.keys, keys, "%#v", test.event)
+		assert.Equal(t, test.all, all, "%#v", test.event)
+	}
+}
+
+func TestChildListUpdate(t *testing.T) {
+	t.Parallel()
+	db := sync.NewDB()
+	children := &childList{order: "score"}
+	changes := children.update(db, newEvent(EventTypePut, "", map[string]interface{}{
+		"alice": map[string]interface{}{"score": 10.0},
+		"bob":   map[string]interface{}{"score": 20.0},
+		"carol": map[string]interface{}{"score": 30.0},
+	}))
+	require.Len(t, changes, 3)
+
+	// a patch of the location only touches the children it holds
+	changes = children.update(db, newEvent(EventTypePatch, "", map[string]interface{}{
+		"alice": nil,
+		"bob":   map[string]interface{}{"score": 40.0},
+		"dave":  map[string]interface{}{"score": 5.0},
+		"carol": map[string]interface{}{"score": 30.0},
+	}))
+
+	kinds := make([]string, len(changes))
+	for i, c := range changes {
+		kinds[i] = c.kind + " " + c.node.Key + " " + c.previousChildKey
+	}
+	assert.Equal(t, []string{
+		childRemovedEvent + " alice ",
+		childAddedEvent + " dave ",
+		childChangedEvent + " bob carol",
+		childMovedEvent + " bob carol",
+	}, kinds)
+
+	keys := make([]string, len(children.nodes))
+	for i, n := range children.nodes {
+		keys[i] = n.Key
+	}
+	assert.Equal(t, []string{"dave", "carol", "bob"}, keys)
+}
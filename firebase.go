@@ -5,8 +5,8 @@ package firego
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -15,25 +15,50 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/zabawaba99/firego/internal/pushid"
 )
 
 // TimeoutDuration is the length of time any request will have to establish
 // a connection and receive headers from Firebase before returning
 // an ErrTimeout error.
+//
+// Deprecated: use NewWithOptions along with WithTimeout to configure
+// the timeout of a single Firebase reference.
 var TimeoutDuration = 30 * time.Second
 
-var defaultRedirectLimit = 30
+const defaultRedirectLimit = 30
 
 // ErrTimeout is an error type is that is returned if a request
-// exceeds the TimeoutDuration configured.
+// exceeds the TimeoutDuration configured or the deadline of
+// its context.
 type ErrTimeout struct {
 	error
 }
 
+// Unwrap returns the underlying error that caused the timeout.
+func (e ErrTimeout) Unwrap() error {
+	return e.error
+}
+
+// ErrCanceled is an error type that is returned if the context
+// of a request is canceled before the request completes.
+type ErrCanceled struct {
+	error
+}
+
+// Unwrap returns the underlying error that caused the cancellation.
+func (e ErrCanceled) Unwrap() error {
+	return e.error
+}
+
 // query parameter constants
 const (
 	authParam         = "auth"
+	accessTokenParam  = "access_token"
 	shallowParam      = "shallow"
+	printParam        = "print"
+	silentVal         = "silent"
 	formatParam       = "format"
 	formatVal         = "export"
 	orderByParam      = "orderBy"
@@ -44,6 +69,17 @@ const (
 	equalToParam      = "equalTo"
 )
 
+// filterParams are the query parameters that filter the data of
+// a location, they do not carry over to other locations.
+var filterParams = []string{
+	orderByParam,
+	limitToFirstParam,
+	limitToLastParam,
+	startAtParam,
+	endAtParam,
+	equalToParam,
+}
+
 const defaultHeartbeat = 2 * time.Minute
 
 // Firebase represents a location in the cloud.
@@ -51,31 +87,59 @@ type Firebase struct {
 	url           string
 	client        *http.Client
 	clientTimeout time.Duration
+	redirectLimit int
+	logger        Logger
+	userAgent     string
+
+	// configMtx guards the settings that decide how
+	// requests are authenticated, sent and retried
+	configMtx       sync.RWMutex
+	retryPolicy     *RetryPolicy
+	reconnectPolicy *ReconnectPolicy
+	interceptors    []Interceptor
+	tokens          *tokenCache
+	streams         *streamManager
+
+	// err is the error returned by every operation of
+	// a reference created from an invalid path
+	err error
 
 	paramsMtx sync.RWMutex
 	params    _url.Values
 
 	eventMtx   sync.Mutex
-	eventFuncs map[string]chan struct{}
+	eventFuncs map[*Subscription]string
 
 	watchMtx       sync.Mutex
 	watching       bool
 	watchHeartbeat time.Duration
-	stopWatching   chan struct{}
+	watchCtx       context.Context
+	stopWatching   context.CancelFunc
 }
 
 // New creates a new Firebase reference,
 // if client is nil, http.DefaultClient is used.
 func New(url string, client *http.Client) *Firebase {
+	return NewWithOptions(url, WithHTTPClient(client))
+}
+
+// NewWithOptions creates a new Firebase reference configured with
+// the given options.
+func NewWithOptions(url string, opts ...Option) *Firebase {
 	fb := &Firebase{
-		url:            sanitizeURL(url),
 		params:         _url.Values{},
 		clientTimeout:  TimeoutDuration,
-		stopWatching:   make(chan struct{}),
+		redirectLimit:  defaultRedirectLimit,
 		watchHeartbeat: defaultHeartbeat,
-		eventFuncs:     map[string]chan struct{}{},
+		eventFuncs:     map[*Subscription]string{},
+		streams:        newStreamManager(),
+	}
+	fb.setURL(url)
+	for _, opt := range opts {
+		opt(fb)
 	}
-	if client == nil {
+
+	if fb.client == nil {
 		var tr *http.Transport
 		tr = &http.Transport{
 			Dial: func(network, address string) (net.Conn, error) {
@@ -86,13 +150,11 @@ func New(url string, client *http.Client) *Firebase {
 			},
 		}
 
-		client = &http.Client{
+		fb.client = &http.Client{
 			Transport:     tr,
-			CheckRedirect: redirectPreserveHeaders,
+			CheckRedirect: redirectPreserveHeaders(fb.redirectLimit),
 		}
 	}
-
-	fb.client = client
 	return fb
 }
 
@@ -103,27 +165,127 @@ func (fb *Firebase) Auth(token string) {
 	fb.paramsMtx.Unlock()
 }
 
-// Unauth removes the current token being used to authenticate to Firebase.
+// Unauth removes the current token being used to authenticate to Firebase,
+// along with the token source or access token, if any.
 func (fb *Firebase) Unauth() {
 	fb.paramsMtx.Lock()
 	fb.params.Del(authParam)
 	fb.paramsMtx.Unlock()
+
+	fb.configMtx.Lock()
+	fb.tokens = nil
+	fb.streams = newStreamManager()
+	fb.configMtx.Unlock()
 }
 
 // Ref returns a copy of an existing Firebase reference with a new path.
+// Query filters are dropped while every other setting is kept. An
+// *InvalidPathError is returned if the path is not accepted by Firebase.
 func (fb *Firebase) Ref(path string) (*Firebase, error) {
-	newFB := fb.copy()
-	parsedURL, err := _url.Parse(fb.url)
+	ref := fb.at(path)
+	return ref, ref.err
+}
+
+// Root returns a reference to the root of the database.
+func (fb *Firebase) Root() *Firebase {
+	return fb.at("")
+}
+
+// Parent returns a reference to the parent location,
+// or nil if the reference is the root of the database.
+func (fb *Firebase) Parent() *Firebase {
+	path := fb.Path()
+	if path == "/" {
+		return nil
+	}
+	return fb.at(path[:strings.LastIndex(path, "/")])
+}
+
+// Key returns the last key of the reference's path,
+// the root of the database has an empty key.
+func (fb *Firebase) Key() string {
+	path := fb.Path()
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// Path returns the path of the reference from the root of the
+// database, such as "/users/bob". The root's path is "/".
+func (fb *Firebase) Path() string {
+	path := fb.url
+	if u, err := _url.Parse(fb.url); err == nil {
+		path = u.Path
+	}
+	return "/" + strings.Trim(path, "/")
+}
+
+// IsEqual reports whether both references point at the
+// same location of the same database with the same query.
+func (fb *Firebase) IsEqual(other *Firebase) bool {
+	if fb == nil || other == nil || fb == other {
+		return fb == other
+	}
+
+	u1, err1 := _url.Parse(fb.url)
+	u2, err2 := _url.Parse(other.url)
+	if err1 != nil || err2 != nil {
+		return fb.url == other.url
+	}
+	if u1.Scheme != u2.Scheme || !strings.EqualFold(u1.Host, u2.Host) || fb.Path() != other.Path() {
+		return false
+	}
+
+	p1, p2 := fb.queryParams(), other.queryParams()
+	for i := range p1 {
+		if p1[i] != p2[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// at returns a copy of the reference pointing at the given path from
+// the root of the database, without the filters of its query.
+func (fb *Firebase) at(path string) *Firebase {
+	c := fb.copy()
+	c.err = nil
+	for _, p := range filterParams {
+		c.params.Del(p)
+	}
+
+	u, err := _url.Parse(fb.url)
 	if err != nil {
-		return newFB, err
+		c.err = err
+		return c
+	}
+	c.url = u.Scheme + "://" + u.Host
+
+	escaped, err := escapePath(path, 0)
+	switch {
+	case err != nil:
+		c.err = err
+		c.url += "/" + strings.Trim(path, "/")
+	case escaped != "":
+		c.url += "/" + escaped
 	}
-	newFB.url = parsedURL.Scheme + "://" + parsedURL.Host + "/" + strings.Trim(path, "/")
-	return newFB, nil
+	return c
+}
+
+// queryParams returns the values of the parameters that determine
+// which database is queried and what data is returned.
+func (fb *Firebase) queryParams() []string {
+	fb.paramsMtx.RLock()
+	defer fb.paramsMtx.RUnlock()
+
+	values := make([]string, 0, len(filterParams)+1)
+	for _, p := range append(filterParams, nsParam) {
+		values = append(values, fb.params.Get(p))
+	}
+	return values
 }
 
 // SetURL changes the url for a firebase reference.
 func (fb *Firebase) SetURL(url string) {
-	fb.url = sanitizeURL(url)
+	fb.setURL(url)
 }
 
 // URL returns firebase reference URL
@@ -133,11 +295,30 @@ func (fb *Firebase) URL() string {
 
 // Push creates a reference to an auto-generated child location.
 func (fb *Firebase) Push(v interface{}) (*Firebase, error) {
+	return fb.PushContext(context.Background(), v)
+}
+
+// NewPushID generates a key in the same format Firebase uses for the
+// children created by Push. Keys are unique and sort in the order they
+// were generated.
+func NewPushID() string {
+	return pushid.New()
+}
+
+// PushRef creates a reference to a new child location named with
+// NewPushID. Unlike Push, no request is made and nothing is written
+// until the returned reference is used.
+func (fb *Firebase) PushRef() *Firebase {
+	return fb.Child(NewPushID())
+}
+
+// PushContext is like Push but the request is bound to the given context.
+func (fb *Firebase) PushContext(ctx context.Context, v interface{}) (*Firebase, error) {
 	bytes, err := json.Marshal(v)
 	if err != nil {
 		return nil, err
 	}
-	_, bytes, err = fb.doRequest("POST", bytes)
+	_, bytes, err = fb.doRequest(ctx, "POST", bytes)
 	if err != nil {
 		return nil, err
 	}
@@ -152,7 +333,12 @@ func (fb *Firebase) Push(v interface{}) (*Firebase, error) {
 
 // Remove the Firebase reference from the cloud.
 func (fb *Firebase) Remove() error {
-	_, _, err := fb.doRequest("DELETE", nil)
+	return fb.RemoveContext(context.Background())
+}
+
+// RemoveContext is like Remove but the request is bound to the given context.
+func (fb *Firebase) RemoveContext(ctx context.Context) error {
+	_, _, err := fb.doRequest(ctx, "DELETE", nil)
 	if err != nil {
 		return err
 	}
@@ -161,28 +347,43 @@ func (fb *Firebase) Remove() error {
 
 // Set the value of the Firebase reference.
 func (fb *Firebase) Set(v interface{}) error {
+	return fb.SetContext(context.Background(), v)
+}
+
+// SetContext is like Set but the request is bound to the given context.
+func (fb *Firebase) SetContext(ctx context.Context, v interface{}) error {
 	bytes, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	_, _, err = fb.doRequest("PUT", bytes)
+	_, _, err = fb.doRequest(ctx, "PUT", bytes)
 	return err
 }
 
 // Update the specific child with the given value.
 func (fb *Firebase) Update(v interface{}) error {
+	return fb.UpdateContext(context.Background(), v)
+}
+
+// UpdateContext is like Update but the request is bound to the given context.
+func (fb *Firebase) UpdateContext(ctx context.Context, v interface{}) error {
 	bytes, err := json.Marshal(v)
 	if err != nil {
 		return err
 	}
-	_, _, err = fb.doRequest("PATCH", bytes)
+	_, _, err = fb.doRequest(ctx, "PATCH", bytes)
 	return err
 }
 
 // Value gets the value of the Firebase reference.
 func (fb *Firebase) Value(v interface{}) error {
-	_, bytes, err := fb.doRequest("GET", nil)
-	if err != nil {
+	return fb.ValueContext(context.Background(), v)
+}
+
+// ValueContext is like Value but the request is bound to the given context.
+func (fb *Firebase) ValueContext(ctx context.Context, v interface{}) error {
+	_, bytes, err := fb.doRequest(ctx, "GET", nil)
+	if err != nil || len(bytes) == 0 {
 		return err
 	}
 	return json.Unmarshal(bytes, v)
@@ -202,10 +403,22 @@ func (fb *Firebase) String() string {
 }
 
 // Child creates a new Firebase reference for the requested
-// child with the same configuration as the parent.
+// child with the same configuration as the parent. The child can be
+// a slash separated path, whose keys are escaped as needed. If it is
+// not accepted by Firebase, every operation of the new reference
+// returns an *InvalidPathError.
 func (fb *Firebase) Child(child string) *Firebase {
 	c := fb.copy()
-	c.url = c.url + "/" + child
+	escaped, err := escapePath(child, fb.depth())
+	switch {
+	case err != nil:
+		if c.err == nil {
+			c.err = err
+		}
+		c.url += "/" + strings.Trim(child, "/")
+	case escaped != "":
+		c.url += "/" + escaped
+	}
 	return c
 }
 
@@ -215,11 +428,22 @@ func (fb *Firebase) copy() *Firebase {
 		params:         _url.Values{},
 		client:         fb.client,
 		clientTimeout:  fb.clientTimeout,
-		stopWatching:   make(chan struct{}),
-		watchHeartbeat: defaultHeartbeat,
-		eventFuncs:     map[string]chan struct{}{},
+		redirectLimit:  fb.redirectLimit,
+		logger:         fb.logger,
+		userAgent:      fb.userAgent,
+		err:            fb.err,
+		watchHeartbeat: fb.watchHeartbeat,
+		eventFuncs:     map[*Subscription]string{},
 	}
 
+	fb.configMtx.RLock()
+	c.retryPolicy = fb.retryPolicy
+	c.reconnectPolicy = fb.reconnectPolicy
+	c.interceptors = append([]Interceptor(nil), fb.interceptors...)
+	c.tokens = fb.tokens
+	c.streams = fb.streams
+	fb.configMtx.RUnlock()
+
 	// making sure to manually copy the map items into a new
 	// map to avoid modifying the map reference.
 	fb.paramsMtx.RLock()
@@ -232,7 +456,16 @@ func (fb *Firebase) copy() *Firebase {
 
 func sanitizeURL(url string) string {
 	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
-		url = "https://" + url
+		host := url
+		if i := strings.IndexAny(host, "/?"); i >= 0 {
+			host = host[:i]
+		}
+		// local emulators do not speak https
+		scheme := "https://"
+		if isLoopback(host) {
+			scheme = "http://"
+		}
+		url = scheme + url
 	}
 
 	if strings.HasSuffix(url, "/") {
@@ -242,76 +475,151 @@ func sanitizeURL(url string) string {
 	return url
 }
 
-// Preserve headers on redirect.
+// Preserve headers on redirect, following at most limit redirects.
 //
 // Reference https://github.com/golang/go/issues/4800
-func redirectPreserveHeaders(req *http.Request, via []*http.Request) error {
-	if len(via) == 0 {
-		// No redirects
+func redirectPreserveHeaders(limit int) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) == 0 {
+			// No redirects
+			return nil
+		}
+
+		if len(via) > limit {
+			return fmt.Errorf("%d consecutive requests(redirects)", len(via))
+		}
+
+		// mutate the subsequent redirect requests with the first Header
+		for key, val := range via[0].Header {
+			req.Header[key] = val
+		}
 		return nil
 	}
+}
 
-	if len(via) > defaultRedirectLimit {
-		return fmt.Errorf("%d consecutive requests(redirects)", len(via))
+// newRequest builds a request for the reference, authenticated
+// with the token of its TokenSource if there is one.
+func (fb *Firebase) newRequest(ctx context.Context, method string, body []byte) (*http.Request, error) {
+	if fb.err != nil {
+		return nil, fb.err
 	}
 
-	// mutate the subsequent redirect requests with the first Header
-	for key, val := range via[0].Header {
-		req.Header[key] = val
+	req, err := http.NewRequest(method, fb.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	req = req.WithContext(ctx)
+
+	if method == "GET" || method == "POST" {
+		// reads and pushes are useless without a response
+		q := req.URL.Query()
+		if q.Get(printParam) == silentVal {
+			q.Del(printParam)
+			req.URL.RawQuery = q.Encode()
+		}
+	}
+
+	if tokens := fb.tokenCache(); tokens != nil {
+		tok, err := tokens.token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		q := req.URL.Query()
+		q.Del(authParam)
+		switch tok.Type {
+		case TokenTypeAccess:
+			q.Set(accessTokenParam, tok.Value)
+		case TokenTypeBearer:
+			req.Header.Set("Authorization", "Bearer "+tok.Value)
+		default:
+			q.Set(authParam, tok.Value)
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+
+	if fb.userAgent != "" {
+		req.Header.Set("User-Agent", fb.userAgent)
+	}
+	return req, nil
 }
 
-func withHeader(key, value string) func(*http.Request) {
-	return func(req *http.Request) {
-		req.Header.Add(key, value)
+func (fb *Firebase) doRequest(ctx context.Context, method string, body []byte, options ...Interceptor) (http.Header, []byte, error) {
+	if len(body) > 0 {
+		depth := fb.depth()
+		if method == "POST" {
+			// pushed data ends up in a new child
+			depth++
+		}
+		if err := validateData(body, depth, method == "PATCH"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// pushing twice creates two children, incrementing twice adds twice
+	idempotent := method != http.MethodPost && !hasIncrement(body)
+	retries := fb.retries()
+	refreshed := false
+	for attempt := 1; ; attempt++ {
+		header, respBody, err := fb.doRequestOnce(ctx, method, body, options...)
+		if err != nil && !refreshed && fb.refreshToken(err) {
+			// try once more with a new token
+			refreshed = true
+			attempt--
+			continue
+		}
+		if err == nil || !retries.wait(ctx, idempotent, attempt, err) {
+			return header, respBody, err
+		}
 	}
 }
 
-func (fb *Firebase) doRequest(method string, body []byte, options ...func(*http.Request)) (http.Header, []byte, error) {
-	req, err := http.NewRequest(method, fb.String(), bytes.NewReader(body))
+func (fb *Firebase) doRequestOnce(ctx context.Context, method string, body []byte, options ...Interceptor) (http.Header, []byte, error) {
+	req, err := fb.newRequest(ctx, method, body)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	for _, opt := range options {
-		opt(req)
+	resp, err := fb.do(req, options...)
+	if err != nil {
+		return nil, nil, requestError(ctx, err)
 	}
 
-	resp, err := fb.client.Do(req)
-	switch err := err.(type) {
-	default:
-		return nil, nil, err
-	case nil:
-		// carry on
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, requestError(ctx, err)
+	}
+	if resp.StatusCode/200 != 1 {
+		return resp.Header, respBody, responseError(req, resp, respBody)
+	}
+	return resp.Header, respBody, nil
+}
+
+// requestError converts an error that occurred while performing
+// a request into an ErrTimeout or ErrCanceled where applicable.
+func requestError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return ErrCanceled{err}
+	case context.DeadlineExceeded:
+		return ErrTimeout{err}
+	}
 
+	switch err := err.(type) {
 	case *_url.Error:
 		// `http.Client.Do` will return a `url.Error` that wraps a `net.Error`
 		// when exceeding it's `Transport`'s `ResponseHeadersTimeout`
 		e1, ok := err.Err.(net.Error)
 		if ok && e1.Timeout() {
-			return nil, nil, ErrTimeout{err}
+			return ErrTimeout{err}
 		}
 
-		return nil, nil, err
-
 	case net.Error:
 		// `http.Client.Do` will return a `net.Error` directly when Dial times
 		// out, or when the Client's RoundTripper otherwise returns an err
 		if err.Timeout() {
-			return nil, nil, ErrTimeout{err}
+			return ErrTimeout{err}
 		}
-
-		return nil, nil, err
 	}
-
-	defer resp.Body.Close()
-	respBody, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, err
-	}
-	if resp.StatusCode/200 != 1 {
-		return resp.Header, respBody, errors.New(string(respBody))
-	}
-	return resp.Header, respBody, nil
+	return err
 }
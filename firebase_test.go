@@ -1,6 +1,8 @@
 package firego
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -197,6 +199,80 @@ func TestChild(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("%s/%s", parent.url, childNode), child.url)
 }
 
+func TestKey(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	assert.Equal(t, "", fb.Key())
+	assert.Equal(t, "node", fb.Child("node").Key())
+	assert.Equal(t, "deep", fb.Child("some/deep/").Key())
+}
+
+func TestPath(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	assert.Equal(t, "/", fb.Path())
+	assert.Equal(t, "/some/deep node", fb.Child("some/deep node").Path())
+}
+
+func TestParent(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	fb.Auth(authToken)
+
+	assert.Nil(t, fb.Parent())
+	child := fb.Child("some/deep node").OrderBy("foo")
+	parent := child.Parent()
+	assert.Equal(t, URL+"/some", parent.url)
+	assert.Equal(t, "some", parent.Key())
+	assert.Equal(t, authToken, parent.params.Get(authParam))
+	assert.Empty(t, parent.params.Get(orderByParam))
+	assert.True(t, parent.Parent().IsEqual(fb))
+
+	// the parent of an invalid path can be valid
+	assert.NoError(t, fb.Child("valid/a.b").Parent().err)
+}
+
+func TestRoot(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	fb.Auth(authToken)
+
+	root := fb.Child("some/deep").LimitToFirst(1).Root()
+	assert.Equal(t, URL, root.url)
+	assert.Equal(t, "", root.Key())
+	assert.Equal(t, authToken, root.params.Get(authParam))
+	assert.Empty(t, root.params.Get(limitToFirstParam))
+}
+
+func TestRefKeepsParams(t *testing.T) {
+	t.Parallel()
+	fb := New(URL+"?ns=foo", nil)
+	fb.Auth(authToken)
+	fb.Shallow(true)
+
+	ref, err := fb.OrderBy("bar").EqualTo("baz").Ref("other")
+	require.NoError(t, err)
+	assert.Equal(t, URL+"/other/.json?auth=token&ns=foo&shallow=true", ref.String())
+}
+
+func TestIsEqual(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	ref, err := fb.Ref("a b/c")
+	require.NoError(t, err)
+
+	assert.True(t, fb.IsEqual(fb))
+	assert.True(t, fb.Child("a b/c").IsEqual(ref))
+	assert.True(t, New(URL+"/a b/c/", nil).IsEqual(ref))
+	assert.True(t, fb.OrderBy("x").IsEqual(fb.OrderBy("x")))
+
+	assert.False(t, fb.IsEqual(nil))
+	assert.False(t, fb.IsEqual(ref))
+	assert.False(t, fb.OrderBy("x").IsEqual(fb))
+	assert.False(t, fb.IsEqual(New("https://other.firebaseio.com", nil)))
+	assert.False(t, fb.IsEqual(NewWithOptions(URL, WithNamespace("other"))))
+}
+
 func TestChild_Issue26(t *testing.T) {
 	t.Parallel()
 	parent := New(URL, nil)
@@ -242,3 +318,98 @@ func TestTimeoutDuration_Dial(t *testing.T) {
 	require.IsType(t, (*http.Transport)(nil), fb.client.Transport)
 	assert.True(t, fb.client.Transport.(*http.Transport).ResponseHeaderTimeout < 0)
 }
+
+func TestContextCanceled(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := fb.SetContext(ctx, true)
+	require.Error(t, err)
+	assert.IsType(t, ErrCanceled{}, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Nil(t, server.Get(""))
+
+	var v interface{}
+	err = fb.ValueContext(ctx, &v)
+	assert.IsType(t, ErrCanceled{}, err)
+}
+
+func TestContextDeadline(t *testing.T) {
+	t.Parallel()
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	fb := New(server.URL, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := fb.UpdateContext(ctx, map[string]string{"foo": "bar"})
+	require.Error(t, err)
+	assert.IsType(t, ErrTimeout{}, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestSilentWrites(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.Silent(true)
+
+	require.NoError(t, fb.Child("foo").Set("bar"))
+	require.NoError(t, fb.Update(map[string]interface{}{"baz": 1}))
+	assert.Equal(t, map[string]interface{}{"foo": "bar", "baz": float64(1)}, server.Get(""))
+
+	pushed, err := fb.Push("hello")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", server.Get(pushed.Key()))
+
+	require.NoError(t, fb.Child("foo").Remove())
+	assert.Nil(t, server.Get("foo"))
+
+	var v map[string]interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, float64(1), v["baz"])
+}
+
+func TestValueNoContent(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	v := "untouched"
+	require.NoError(t, New(server.URL, nil).Value(&v))
+	assert.Equal(t, "untouched", v)
+}
+
+func TestPushRef(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := New(server.URL, nil).Child("items")
+	first, second := fb.PushRef(), fb.PushRef()
+	assert.Len(t, server.receivedReqs, 0)
+
+	assert.Len(t, first.Key(), 20)
+	assert.True(t, second.Key() > first.Key())
+	assert.Equal(t, fb.url+"/"+first.Key(), first.url)
+
+	first.Set(true)
+	require.Len(t, server.receivedReqs, 1)
+	assert.Equal(t, "/items/"+first.Key()+"/.json", server.receivedReqs[0].URL.Path)
+}
@@ -1,17 +1,27 @@
 package firetest
 
 import (
-	"encoding/base64"
 	"fmt"
 	"sync/atomic"
-	"time"
 
+	"github.com/zabawaba99/firego/internal/pushid"
 	"github.com/zabawaba99/firego/sync"
 )
 
 // RequireAuth determines whether or not a Firetest server
-// will require that each request be authorized
-func (ft *Firetest) RequireAuth(v bool) {
+// will require that each request be authorized. Besides the secret
+// and custom tokens signed with it, the given OAuth2 access tokens
+// are accepted, either as a bearer token in the Authorization header
+// or as the access_token parameter.
+func (ft *Firetest) RequireAuth(v bool, bearerTokens ...string) {
+	tokens := make(map[string]bool, len(bearerTokens))
+	for _, t := range bearerTokens {
+		tokens[t] = true
+	}
+	ft.bearerTokensMtx.Lock()
+	ft.bearerTokens = tokens
+	ft.bearerTokensMtx.Unlock()
+
 	var val int32
 	if v {
 		val = 1
@@ -20,12 +30,12 @@ func (ft *Firetest) RequireAuth(v bool) {
 }
 
 // Create generates a new child under the given location
-// using a unique name and returns the name
+// using a unique name, in the same format Firebase uses,
+// and returns the name
 //
 // Reference https://www.firebase.com/docs/rest/api/#section-post
 func (ft *Firetest) Create(path string, v interface{}) string {
-	src := []byte(fmt.Sprint(time.Now().UnixNano()))
-	name := "~" + base64.StdEncoding.EncodeToString(src)
+	name := pushid.New()
 
 	path = fmt.Sprintf("%s/%s", sanitizePath(path), name)
 	// sanitize one more time in case initial path was empty
@@ -47,16 +57,12 @@ func (ft *Firetest) Delete(path string) {
 // and will leave others untouched. Note that the update function is equivalent
 // to calling Set() on the named children; it does not recursively update children
 // if they are objects. Passing null as a value for a child is equivalent to
-// calling remove() on that child.
+// calling remove() on that child. The names of the children can be slash
+// separated paths to deeper locations, all of which are written atomically.
 //
 // Reference https://www.firebase.com/docs/rest/api/#section-patch
 func (ft *Firetest) Update(path string, v interface{}) {
-	path = sanitizePath(path)
-	if v == nil {
-		ft.db.del(path)
-	} else {
-		ft.db.update(path, sync.NewNode("", v))
-	}
+	ft.db.updateValue(sanitizePath(path), v)
 }
 
 // Set writes data to at the given location.
@@ -72,9 +78,5 @@ func (ft *Firetest) Set(path string, v interface{}) {
 //
 // Reference https://www.firebase.com/docs/rest/api/#section-get
 func (ft *Firetest) Get(path string) (v interface{}) {
-	n := ft.db.intDB.Get(sanitizePath(path))
-	if n != nil {
-		v = n.Objectify()
-	}
-	return v
+	return ft.db.value(sanitizePath(path))
 }
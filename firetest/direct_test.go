@@ -1,7 +1,6 @@
 package firetest
 
 import (
-	"strings"
 	"sync/atomic"
 	"testing"
 
@@ -27,9 +26,12 @@ func TestCreate(t *testing.T) {
 		v  = true
 	)
 
+	var previous string
 	for _, p := range []string{"path/hi", ""} {
 		name := ft.Create(p, v)
-		assert.True(t, strings.HasPrefix(name, "~"), "name is missing `~` prefix")
+		assert.Len(t, name, 20)
+		assert.True(t, name > previous, "names do not sort chronologically")
+		previous = name
 
 		n := ft.db.get(sanitizePath(p + "/" + name))
 		assert.Equal(t, v, n.Value)
@@ -0,0 +1,52 @@
+package firetest
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+// header constants used for conditional requests
+const (
+	etagHeader        = "ETag"
+	requestETagHeader = "X-Firebase-ETag"
+	ifMatchHeader     = "if-match"
+)
+
+// etagOf computes the ETag of the given node, two nodes holding
+// the same data always have the same ETag.
+//
+// Reference https://firebase.google.com/docs/database/rest/app-management#conditional-requests
+func etagOf(n *sync.Node) string {
+	var v interface{}
+	if n != nil {
+		v = n.Objectify()
+	}
+
+	// map keys are sorted when marshaled so the output is stable
+	b, _ := json.Marshal(v)
+	sum := sha1.Sum(b)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// swap writes v at the location of the request, or removes it if v is
+// nil, only if the data currently there matches etag. When it does not
+// the request is rejected with the current ETag and value.
+func swap(db *notifyDB, w http.ResponseWriter, req *http.Request, etag string, v interface{}) {
+	current, ok := db.swap(sanitizePath(req.URL.Path), etag, v)
+	w.Header().Set(etagHeader, etagOf(current))
+
+	var data interface{}
+	if current != nil {
+		data = current.Objectify()
+	}
+	if !ok {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		writeJSON(w, data)
+		return
+	}
+	writeResult(w, req, data)
+}
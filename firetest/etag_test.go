@@ -0,0 +1,68 @@
+package firetest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/sync"
+)
+
+func TestEtagOf(t *testing.T) {
+	a := sync.NewNode("", map[string]interface{}{"a": 1, "b": "foo"})
+	b := sync.NewNode("", map[string]interface{}{"b": "foo", "a": 1})
+	c := sync.NewNode("", map[string]interface{}{"a": 2, "b": "foo"})
+
+	assert.Equal(t, etagOf(a), etagOf(b))
+	assert.NotEqual(t, etagOf(a), etagOf(c))
+	assert.NotEqual(t, etagOf(a), etagOf(nil))
+}
+
+func TestServerConditionalRequests(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+	ft.Set("foo", "bar")
+
+	serve := func(method, body string, header ...string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, ft.URL+"/foo.json", strings.NewReader(body))
+		require.NoError(t, err)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+		return resp
+	}
+
+	// get the etag
+	resp := serve("GET", "", requestETagHeader, "true")
+	assert.Equal(t, http.StatusOK, resp.Code)
+	etag := resp.Header().Get(etagHeader)
+	require.NotEmpty(t, etag)
+
+	// stale etag
+	resp = serve("PUT", `"baz"`, ifMatchHeader, "stale")
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	assert.Equal(t, etag, resp.Header().Get(etagHeader))
+	assert.Equal(t, `"bar"`, resp.Body.String())
+	assert.Equal(t, "bar", ft.Get("foo"))
+
+	// matching etag
+	resp = serve("PUT", `"baz"`, ifMatchHeader, etag)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `"baz"`, resp.Body.String())
+	assert.Equal(t, "baz", ft.Get("foo"))
+
+	// the old etag is no longer valid for removals
+	resp = serve("DELETE", "", ifMatchHeader, etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	assert.Equal(t, "baz", ft.Get("foo"))
+
+	resp = serve("DELETE", "", ifMatchHeader, resp.Header().Get(etagHeader))
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Nil(t, ft.Get("foo"))
+}
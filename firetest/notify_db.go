@@ -17,18 +17,32 @@ type event struct {
 type eventData struct {
 	Path string     `json:"path"`
 	Data *sync.Node `json:"data"`
+
+	// export determines whether priorities are sent along with the data
+	export bool
 }
 
 func (ed eventData) MarshalJSON() ([]byte, error) {
-	type eventData2 eventData
-	ed2 := eventData2(ed)
-	ed2.Path = "/" + ed2.Path
-	return json.Marshal(ed2)
+	var data interface{}
+	if ed.Data != nil {
+		data = ed.Data.Objectify()
+		if ed.export {
+			data = ed.Data.Export()
+		}
+	}
+
+	return json.Marshal(struct {
+		Path string      `json:"path"`
+		Data interface{} `json:"data"`
+	}{
+		Path: "/" + ed.Path,
+		Data: data,
+	})
 }
 
 func newEvent(name, path string, n *sync.Node) event {
 	return event{
-		Name: "put",
+		Name: name,
 		Data: eventData{
 			Path: path,
 			Data: n,
@@ -37,6 +51,8 @@ func newEvent(name, path string, n *sync.Node) event {
 }
 
 type notifyDB struct {
+	// mtx makes writes that touch several locations atomic
+	mtx   _sync.RWMutex
 	intDB *sync.Database
 
 	watchersMtx _sync.RWMutex
@@ -51,39 +67,164 @@ func newNotifyDB() *notifyDB {
 }
 
 func (db *notifyDB) add(path string, n *sync.Node) {
+	db.mtx.Lock()
 	db.intDB.Add(path, n)
+	db.mtx.Unlock()
 	go db.notify(newEvent("put", path, n))
 }
 
 func (db *notifyDB) update(path string, n *sync.Node) {
+	db.mtx.Lock()
 	db.intDB.Update(path, n)
+	db.mtx.Unlock()
 	go db.notify(newEvent("patch", path, n))
 }
 
+// addResolved resolves the server values of v and writes the result
+// at path, without letting other writes in between so that concurrent
+// increments all count. It returns the value that was written.
+func (db *notifyDB) addResolved(path string, v interface{}) interface{} {
+	db.mtx.Lock()
+	v = db.resolveServerValues(path, v)
+	n := sync.NewNode("", v)
+	db.intDB.Add(path, n)
+	db.mtx.Unlock()
+	go db.notify(newEvent("put", path, n))
+	return v
+}
+
+// updateChildren replaces every child of path found in values, whose
+// keys can be slash separated paths, and removes the ones set to nil.
+// All the children are written at once and a single patch is sent.
+func (db *notifyDB) updateChildren(path string, values map[string]interface{}) {
+	db.mtx.Lock()
+	e := db.patchChildren(path, values)
+	db.mtx.Unlock()
+	go db.notify(e)
+}
+
+// updateValue writes v at path the way a PATCH request does, objects
+// only replace the children they hold and nil removes the location.
+func (db *notifyDB) updateValue(path string, v interface{}) {
+	db.mtx.Lock()
+	e := db.patch(path, v)
+	db.mtx.Unlock()
+	go db.notify(e)
+}
+
+// updateResolved is like updateValue but it first resolves the server
+// values of v, under the same lock. It returns the value that was written.
+func (db *notifyDB) updateResolved(path string, v interface{}) interface{} {
+	db.mtx.Lock()
+	v = db.resolveServerValues(path, v)
+	e := db.patch(path, v)
+	db.mtx.Unlock()
+	go db.notify(e)
+	return v
+}
+
+// patch writes v at path the way updateValue does and returns
+// the event to notify, db.mtx must be held.
+func (db *notifyDB) patch(path string, v interface{}) event {
+	switch val := v.(type) {
+	case nil:
+		db.intDB.Del(path)
+		return newEvent("put", path, nil)
+	case map[string]interface{}:
+		return db.patchChildren(path, val)
+	}
+	n := sync.NewNode("", v)
+	db.intDB.Update(path, n)
+	return newEvent("patch", path, n)
+}
+
+// patchChildren writes the children the way updateChildren does and
+// returns the event to notify, db.mtx must be held.
+func (db *notifyDB) patchChildren(path string, values map[string]interface{}) event {
+	for k, v := range values {
+		childPath := sanitizePath(path + "/" + k)
+		if v == nil {
+			db.intDB.Del(childPath)
+			continue
+		}
+		db.intDB.Add(childPath, sync.NewNode("", v))
+	}
+	return newEvent("patch", path, sync.NewNode("", values))
+}
+
 func (db *notifyDB) del(path string) {
+	db.mtx.Lock()
 	db.intDB.Del(path)
+	db.mtx.Unlock()
 	go db.notify(newEvent("put", path, nil))
 }
 
+// swap replaces the node at path with v, once its server values are
+// resolved, or removes it if v is nil, only if the ETag of the current
+// node matches etag. It returns the node that is at path once it is
+// done and whether it was replaced.
+func (db *notifyDB) swap(path, etag string, v interface{}) (*sync.Node, bool) {
+	db.mtx.Lock()
+	if current := db.intDB.Get(path); etagOf(current) != etag {
+		db.mtx.Unlock()
+		return current, false
+	}
+
+	var n *sync.Node
+	if v == nil {
+		db.intDB.Del(path)
+	} else {
+		n = sync.NewNode("", db.resolveServerValues(path, v))
+		db.intDB.Add(path, n)
+	}
+	db.mtx.Unlock()
+	go db.notify(newEvent("put", path, n))
+	return n, true
+}
+
+// setPriority changes the priority of the node at path, if there is one.
+func (db *notifyDB) setPriority(path string, priority interface{}) {
+	db.mtx.Lock()
+	current := db.intDB.Get(path)
+	if current == nil {
+		db.mtx.Unlock()
+		return
+	}
+
+	// nodes are never modified in place since they
+	// could be read by someone else at the same time
+	n := sync.NewNode("", current.Export())
+	n.Priority = priority
+	db.intDB.Add(path, n)
+	db.mtx.Unlock()
+	go db.notify(newEvent("put", path, n))
+}
+
 func (db *notifyDB) get(path string) *sync.Node {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
 	return db.intDB.Get(path)
 }
 
+// value returns the data stored at path as plain Go values.
+func (db *notifyDB) value(path string) (v interface{}) {
+	if n := db.get(path); n != nil {
+		v = n.Objectify()
+	}
+	return v
+}
+
 func (db *notifyDB) notify(e event) {
 	db.watchersMtx.RLock()
 	for path, listeners := range db.watchers {
-		if !strings.HasPrefix(e.Data.Path, path) {
+		we, ok := eventFor(path, e)
+		if !ok {
 			continue
 		}
 
-		// Make sure to not return full path when notifying
-		// only return the path relative to the watcher
-		e.Data.Path = strings.TrimPrefix(e.Data.Path, path)
-		e.Data.Path = sanitizePath(e.Data.Path)
-
 		for _, c := range listeners {
 			select {
-			case c <- e:
+			case c <- we:
 			case <-time.After(250 * time.Millisecond):
 				continue
 			}
@@ -92,6 +233,60 @@ func (db *notifyDB) notify(e event) {
 	db.watchersMtx.RUnlock()
 }
 
+// eventFor builds the event that the watcher of the given path
+// should receive for e, it returns false if the watcher is not
+// affected by e.
+func eventFor(path string, e event) (event, bool) {
+	switch {
+	case path == "" || e.Data.Path == path || strings.HasPrefix(e.Data.Path, path+"/"):
+		// Make sure to not return full path when notifying
+		// only return the path relative to the watcher
+		e.Data.Path = sanitizePath(strings.TrimPrefix(e.Data.Path, path))
+		return e, true
+
+	case e.Data.Path == "" || strings.HasPrefix(path, e.Data.Path+"/"):
+		// the change happened above the watched location
+		rel := sanitizePath(strings.TrimPrefix(path, e.Data.Path))
+		if e.Name == "patch" {
+			return patchFor(rel, e.Data.Data)
+		}
+		return newEvent("put", "", childNode(e.Data.Data, rel)), true
+	}
+	return e, false
+}
+
+// patchFor narrows down a patch applied to an ancestor of the watched
+// location, rel is the path to the watched location from that ancestor.
+func patchFor(rel string, patch *sync.Node) (event, bool) {
+	children := map[string]interface{}{}
+	for k, child := range patch.Children {
+		switch {
+		case k == rel:
+			return newEvent("put", "", child), true
+		case strings.HasPrefix(rel, k+"/"):
+			return newEvent("put", "", childNode(child, strings.TrimPrefix(rel, k+"/"))), true
+		case strings.HasPrefix(k, rel+"/"):
+			children[strings.TrimPrefix(k, rel+"/")] = child.Objectify()
+		}
+	}
+
+	if len(children) == 0 {
+		return event{}, false
+	}
+	return newEvent("patch", "", sync.NewNode("", children)), true
+}
+
+func childNode(n *sync.Node, path string) *sync.Node {
+	if n == nil {
+		return nil
+	}
+	child, ok := n.Child(path)
+	if !ok {
+		return nil
+	}
+	return child
+}
+
 func (db *notifyDB) stopWatching(path string, c chan event) {
 	db.watchersMtx.Lock()
 	index := -1
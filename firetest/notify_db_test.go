@@ -84,3 +84,105 @@ func TestNotifyDBDel(t *testing.T) {
 	}
 	db.stopWatching("", notifications)
 }
+
+func TestNotifyDBUpdateChildren(t *testing.T) {
+	db := newNotifyDB()
+	// seed the data without notifications that could reach the watcher
+	db.intDB.Add("users/alice/name", sync.NewNode("", "Alice"))
+	db.intDB.Add("users/bob/name", sync.NewNode("", "Bob"))
+
+	notifications := db.watch("users/alice")
+	exited := make(chan struct{})
+	go func() {
+		n, ok := <-notifications
+		assert.True(t, ok)
+		assert.Equal(t, "patch", n.Name)
+		assert.Equal(t, "", n.Data.Path)
+		assert.Equal(t, map[string]interface{}{"age": 30}, n.Data.Data.Objectify())
+		close(exited)
+	}()
+
+	db.updateChildren("users", map[string]interface{}{
+		"alice/age": 30,
+		"bob":       nil,
+	})
+
+	assert.Equal(t, map[string]interface{}{
+		"alice": map[string]interface{}{"name": "Alice", "age": 30},
+	}, db.get("users").Objectify())
+
+	select {
+	case <-exited:
+	case <-time.After(250 * time.Millisecond):
+		assert.Fail(t, "did not receive a notification")
+	}
+	db.stopWatching("users/alice", notifications)
+}
+
+func TestEventFor(t *testing.T) {
+	put := newEvent("put", "a/b", sync.NewNode("", map[string]interface{}{"c": map[string]interface{}{"d": 1}}))
+	patch := newEvent("patch", "a", sync.NewNode("", map[string]interface{}{"b/c": 1, "x": 2}))
+
+	for _, test := range []struct {
+		name     string
+		path     string
+		e        event
+		ok       bool
+		expected event
+	}{
+		{
+			name:     "put at watched location",
+			path:     "a/b",
+			e:        put,
+			ok:       true,
+			expected: newEvent("put", "", put.Data.Data),
+		},
+		{
+			name:     "put below watched location",
+			path:     "a",
+			e:        put,
+			ok:       true,
+			expected: newEvent("put", "b", put.Data.Data),
+		},
+		{
+			name:     "put above watched location",
+			path:     "a/b/c",
+			e:        put,
+			ok:       true,
+			expected: newEvent("put", "", put.Data.Data.Children["c"]),
+		},
+		{
+			name: "put at a sibling",
+			path: "a/bb",
+			e:    put,
+		},
+		{
+			name:     "patch above watched location",
+			path:     "a/b",
+			e:        patch,
+			ok:       true,
+			expected: newEvent("patch", "", sync.NewNode("", map[string]interface{}{"c": 1})),
+		},
+		{
+			name:     "patch replacing watched location",
+			path:     "a/x",
+			e:        patch,
+			ok:       true,
+			expected: newEvent("put", "", patch.Data.Data.Children["x"]),
+		},
+		{
+			name: "patch not touching watched location",
+			path: "a/y",
+			e:    patch,
+		},
+	} {
+		e, ok := eventFor(test.path, test.e)
+		assert.Equal(t, test.ok, ok, test.name)
+		if !test.ok {
+			continue
+		}
+		assert.Equal(t, test.expected.Name, e.Name, test.name)
+		assert.Equal(t, test.expected.Data.Path, e.Data.Path, test.name)
+		assert.Equal(t, test.expected.Data.Data.Objectify(), e.Data.Data.Objectify(), test.name)
+	}
+}
@@ -16,8 +16,11 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	_sync "sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/zabawaba99/firego/internal/pushid"
 )
 
 var (
@@ -37,7 +40,13 @@ type Firetest struct {
 	listener net.Listener
 	db       *notifyDB
 
+	namespacesMtx _sync.Mutex
+	namespaces    map[string]*notifyDB
+
 	requireAuth *int32
+
+	bearerTokensMtx _sync.RWMutex
+	bearerTokens    map[string]bool
 }
 
 // New creates a new Firetest server
@@ -45,6 +54,7 @@ func New() *Firetest {
 	secret := []byte(fmt.Sprint(time.Now().UnixNano()))
 	return &Firetest{
 		db:          newNotifyDB(),
+		namespaces:  map[string]*notifyDB{},
 		Secret:      base64.URLEncoding.EncodeToString(secret),
 		requireAuth: new(int32),
 	}
@@ -87,21 +97,10 @@ func (ft *Firetest) serveHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if atomic.LoadInt32(ft.requireAuth) == 1 {
-		var authenticated bool
-		authHeader := req.URL.Query().Get("auth")
-		switch {
-		case strings.Contains(authHeader, "."):
-			authenticated = ft.validJWT(authHeader)
-		default:
-			authenticated = authHeader == ft.Secret
-		}
-
-		if !authenticated {
-			w.WriteHeader(http.StatusUnauthorized)
-			w.Write(invalidAuth)
-			return
-		}
+	if atomic.LoadInt32(ft.requireAuth) == 1 && !ft.authenticated(req) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(invalidAuth)
+		return
 	}
 
 	switch req.Method {
@@ -126,6 +125,47 @@ func (ft *Firetest) serveHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// namespace returns the database the request is made against, named by
+// the ns parameter the same way the emulator does. Requests without one
+// use the database managed through the direct API.
+func (ft *Firetest) namespace(req *http.Request) *notifyDB {
+	ns := req.URL.Query().Get("ns")
+	if ns == "" {
+		return ft.db
+	}
+
+	ft.namespacesMtx.Lock()
+	defer ft.namespacesMtx.Unlock()
+	db, ok := ft.namespaces[ns]
+	if !ok {
+		db = newNotifyDB()
+		ft.namespaces[ns] = db
+	}
+	return db
+}
+
+func (ft *Firetest) authenticated(req *http.Request) bool {
+	if token := bearerToken(req); token != "" {
+		ft.bearerTokensMtx.RLock()
+		defer ft.bearerTokensMtx.RUnlock()
+		return ft.bearerTokens[token]
+	}
+
+	authHeader := req.URL.Query().Get("auth")
+	if strings.Contains(authHeader, ".") {
+		return ft.validJWT(authHeader)
+	}
+	return authHeader == ft.Secret
+}
+
+// bearerToken returns the OAuth2 access token sent with the request, if any.
+func bearerToken(req *http.Request) string {
+	if h := req.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	return req.URL.Query().Get("access_token")
+}
+
 func decodeSegment(seg string) ([]byte, error) {
 	if l := len(seg) % 4; l > 0 {
 		seg += strings.Repeat("=", 4-l)
@@ -166,6 +206,48 @@ func (ft *Firetest) validJWT(val string) bool {
 		log.Println("error unmarshaling claim", err)
 		return false
 	}
+	if !validClaim(claim) {
+		return false
+	}
+
+	sig, err := decodeSegment(parts[2])
+	if err != nil {
+		log.Println("error decoding signature", err)
+		return false
+	}
+	hasher := hmac.New(sha256.New, []byte(ft.Secret))
+	signedString := strings.Join(parts[:2], ".")
+	hasher.Write([]byte(signedString))
+
+	if !hmac.Equal(sig, hasher.Sum(nil)) {
+		log.Println("invalid jwt signature")
+		return false
+	}
+
+	return true
+}
+
+// validClaim validates the claims of a custom token.
+//
+// Reference https://www.firebase.com/docs/rest/guide/user-auth.html#section-rest-tokens-without-helpers
+func validClaim(claim map[string]interface{}) bool {
+	now := float64(time.Now().Unix())
+
+	if v, ok := claim["v"]; ok && v != float64(0) {
+		log.Println("unsupported token version")
+		return false
+	}
+
+	iat, ok := claim["iat"].(float64)
+	if !ok {
+		log.Println("issued at missing or not a number")
+		return false
+	}
+	if iat > now+60 {
+		log.Println("token issued in the future")
+		return false
+	}
+
 	if e, ok := claim["exp"]; ok {
 		// make sure not expired
 		exp, ok := e.(float64)
@@ -173,14 +255,40 @@ func (ft *Firetest) validJWT(val string) bool {
 			log.Println("expiration not a number")
 			return false
 		}
-		if int64(exp) < time.Now().Unix() {
+		if exp < now {
 			log.Println("token expired")
 			return false
 		}
 	}
-	// ensure uid present
+
+	if n, ok := claim["nbf"]; ok {
+		// make sure already valid
+		nbf, ok := n.(float64)
+		if !ok {
+			log.Println("not before not a number")
+			return false
+		}
+		if nbf > now {
+			log.Println("token not valid yet")
+			return false
+		}
+	}
+
+	for _, k := range []string{"admin", "debug"} {
+		if v, ok := claim[k]; ok {
+			if _, ok := v.(bool); !ok {
+				log.Printf("claim['%s'] is not a boolean", k)
+				return false
+			}
+		}
+	}
+
 	data, ok := claim["d"]
 	if !ok {
+		// admins do not need to be identified
+		if admin, _ := claim["admin"].(bool); admin {
+			return true
+		}
 		log.Println("missing data in claim")
 		return false
 	}
@@ -191,42 +299,44 @@ func (ft *Firetest) validJWT(val string) bool {
 		return false
 	}
 
-	if _, ok := d["uid"]; !ok {
+	if _, ok := d["uid"].(string); !ok {
 		log.Println("claim['data'] missing uid")
 		return false
 	}
 
-	if sig, err := decodeSegment(parts[2]); err == nil {
-		hasher := hmac.New(sha256.New, []byte(ft.Secret))
-		signedString := strings.Join(parts[:2], ".")
-		hasher.Write([]byte(signedString))
-
-		if !hmac.Equal(sig, hasher.Sum(nil)) {
-			log.Println("invalid jwt signature")
-			return false
-		}
-	}
-
 	return true
 }
 
 func (ft *Firetest) set(w http.ResponseWriter, req *http.Request) {
-	body, v, ok := unmarshal(w, req.Body)
+	_, v, ok := unmarshal(w, req.Body)
 	if !ok {
 		return
 	}
 
-	ft.Set(req.URL.Path, v)
-	w.Write(body)
+	db := ft.namespace(req)
+	path := sanitizePath(req.URL.Path)
+	if parent, ok := priorityPath(path); ok {
+		db.setPriority(parent, v)
+		writeResult(w, req, v)
+		return
+	}
+
+	if etag := req.Header.Get(ifMatchHeader); etag != "" {
+		swap(db, w, req, etag, v)
+		return
+	}
+	writeResult(w, req, db.addResolved(path, v))
 }
 
 func (ft *Firetest) update(w http.ResponseWriter, req *http.Request) {
-	body, v, ok := unmarshal(w, req.Body)
+	_, v, ok := unmarshal(w, req.Body)
 	if !ok {
 		return
 	}
-	ft.Update(req.URL.Path, v)
-	w.Write(body)
+
+	db := ft.namespace(req)
+	path := sanitizePath(req.URL.Path)
+	writeResult(w, req, db.updateResolved(path, v))
 }
 
 func (ft *Firetest) create(w http.ResponseWriter, req *http.Request) {
@@ -235,22 +345,40 @@ func (ft *Firetest) create(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	name := ft.Create(req.URL.Path, v)
-	rtn := map[string]string{"name": name}
-	if err := json.NewEncoder(w).Encode(rtn); err != nil {
-		log.Printf("Error encoding json: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+	db := ft.namespace(req)
+	name := pushid.New()
+	path := sanitizePath(sanitizePath(req.URL.Path) + "/" + name)
+	db.addResolved(path, v)
+	writeJSON(w, map[string]string{"name": name})
 }
 
 func (ft *Firetest) del(w http.ResponseWriter, req *http.Request) {
-	ft.Delete(req.URL.Path)
+	db := ft.namespace(req)
+	if etag := req.Header.Get(ifMatchHeader); etag != "" {
+		swap(db, w, req, etag, nil)
+		return
+	}
+	db.del(sanitizePath(req.URL.Path))
+	if silent(req) {
+		w.WriteHeader(http.StatusNoContent)
+	}
 }
 
 func (ft *Firetest) get(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 
-	v := ft.Get(req.URL.Path)
+	n := ft.namespace(req).get(sanitizePath(req.URL.Path))
+	if req.Header.Get(requestETagHeader) == "true" {
+		w.Header().Set(etagHeader, etagOf(n))
+	}
+
+	var v interface{}
+	if n != nil {
+		v = n.Objectify()
+		if exportFormat(req) {
+			v = n.Export()
+		}
+	}
 	if err := json.NewEncoder(w).Encode(v); err != nil {
 		log.Printf("Error encoding json: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -266,11 +394,13 @@ func (ft *Firetest) sse(w http.ResponseWriter, req *http.Request) {
 
 	w.Header().Set("Content-Type", "text/event-stream")
 
+	db := ft.namespace(req)
 	path := sanitizePath(req.URL.Path)
-	c := ft.db.watch(path)
-	defer ft.db.stopWatching(path, c)
+	c := db.watch(path)
+	defer db.stopWatching(path, c)
 
-	d := eventData{Path: path, Data: ft.db.get(path)}
+	export := exportFormat(req)
+	d := eventData{Path: "", Data: db.get(path), export: export}
 	s, err := json.Marshal(d)
 	if err != nil {
 		fmt.Printf("Error marshaling node %s\n", err)
@@ -292,6 +422,7 @@ func (ft *Firetest) sse(w http.ResponseWriter, req *http.Request) {
 				return
 			}
 
+			n.Data.export = export
 			s, err := json.Marshal(n.Data)
 			if err != nil {
 				fmt.Printf("Error marshaling node %s\n", err)
@@ -318,6 +449,46 @@ func sanitizePath(p string) string {
 	return strings.TrimSuffix(s, "/")
 }
 
+// exportFormat reports whether the request asked for
+// priorities to be included in the response.
+func exportFormat(req *http.Request) bool {
+	return req.URL.Query().Get("format") == "export"
+}
+
+// priorityPath reports whether path points to the priority
+// of a location and returns the path of that location.
+func priorityPath(path string) (string, bool) {
+	if path != ".priority" && !strings.HasSuffix(path, "/.priority") {
+		return "", false
+	}
+	return sanitizePath(strings.TrimSuffix(path, ".priority")), true
+}
+
+// silent reports whether the request asked for an empty response.
+func silent(req *http.Request) bool {
+	return req.URL.Query().Get("print") == "silent"
+}
+
+// writeResult sends back the data written by req unless it asked
+// for an empty response.
+func writeResult(w http.ResponseWriter, req *http.Request, v interface{}) {
+	if silent(req) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, v)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding json: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Write(b)
+}
+
 func unmarshal(w http.ResponseWriter, r io.Reader) ([]byte, interface{}, bool) {
 	body, err := ioutil.ReadAll(r)
 	if err != nil || len(body) == 0 {
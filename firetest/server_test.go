@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -104,6 +105,30 @@ func TestValidJWT(t *testing.T) {
 	}
 }
 
+func TestValidClaim(t *testing.T) {
+	now := float64(time.Now().Unix())
+	data := map[string]interface{}{"uid": "1"}
+	for _, test := range []struct {
+		name  string
+		claim map[string]interface{}
+		pass  bool
+	}{
+		{name: "minimal", claim: map[string]interface{}{"iat": now, "d": data}, pass: true},
+		{name: "all claims", claim: map[string]interface{}{"v": 0.0, "iat": now, "d": data, "exp": now + 60, "nbf": now - 60, "admin": false, "debug": true}, pass: true},
+		{name: "admin without data", claim: map[string]interface{}{"iat": now, "admin": true}, pass: true},
+		{name: "unknown version", claim: map[string]interface{}{"v": 1.0, "iat": now, "d": data}},
+		{name: "missing iat", claim: map[string]interface{}{"d": data}},
+		{name: "iat in the future", claim: map[string]interface{}{"iat": now + 3600, "d": data}},
+		{name: "not valid yet", claim: map[string]interface{}{"iat": now, "d": data, "nbf": now + 3600}},
+		{name: "invalid nbf", claim: map[string]interface{}{"iat": now, "d": data, "nbf": "now"}},
+		{name: "invalid admin", claim: map[string]interface{}{"iat": now, "d": data, "admin": "yes"}},
+		{name: "invalid debug", claim: map[string]interface{}{"iat": now, "d": data, "debug": 1.0}},
+		{name: "uid not a string", claim: map[string]interface{}{"iat": now, "d": map[string]interface{}{"uid": 1.0}}},
+	} {
+		assert.Equal(t, test.pass, validClaim(test.claim), test.name)
+	}
+}
+
 func TestServeHTTP(t *testing.T) {
 	// ARRANGE
 	ft := New()
@@ -188,6 +213,46 @@ func TestServeHTTPAuth(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 }
 
+func TestServeHTTPAuthBearer(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.RequireAuth(true, "good-token")
+
+	for _, test := range []struct {
+		name   string
+		query  string
+		header string
+		status int
+	}{
+		{name: "header", header: "Bearer good-token", status: http.StatusOK},
+		{name: "param", query: "?access_token=good-token", status: http.StatusOK},
+		{name: "unknown token", header: "Bearer bad-token", status: http.StatusUnauthorized},
+		{name: "not a bearer token", header: "Basic good-token", status: http.StatusUnauthorized},
+	} {
+		// ACT
+		req, err := http.NewRequest("GET", ft.URL+"/.json"+test.query, nil)
+		require.NoError(t, err)
+		if test.header != "" {
+			req.Header.Set("Authorization", test.header)
+		}
+
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+
+		// ASSERT
+		assert.Equal(t, test.status, resp.Code, test.name)
+	}
+
+	// tokens are forgotten when auth is required again
+	ft.RequireAuth(true)
+	req, err := http.NewRequest("GET", ft.URL+"/.json?access_token=good-token", nil)
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
 func TestServeHTTPUnauthorized(t *testing.T) {
 	// ARRANGE
 	ft := New()
@@ -411,3 +476,73 @@ func TestUnmarshal_InvalidBody(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, []byte(invalidJSON), w.Body.Bytes())
 }
+
+func TestServerSilent(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		// ACT
+		req, err := http.NewRequest(method, ft.URL+"/foo.json?print=silent", strings.NewReader(`{"bar":true}`))
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+
+		// ASSERT
+		assert.Equal(t, http.StatusNoContent, resp.Code, method)
+		assert.Empty(t, resp.Body.String(), method)
+	}
+}
+
+func TestServerPriority(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("foo", "bar")
+
+	// ACT
+	req, err := http.NewRequest("PUT", ft.URL+"/foo/.priority.json", strings.NewReader(`1`))
+	require.NoError(t, err)
+	resp := httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// ASSERT
+	assert.Equal(t, "bar", ft.Get("foo"))
+
+	req, err = http.NewRequest("GET", ft.URL+"/foo.json?format=export", nil)
+	require.NoError(t, err)
+	resp = httptest.NewRecorder()
+	ft.serveHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{".value":"bar",".priority":1}`, resp.Body.String())
+}
+
+func TestServerNamespaces(t *testing.T) {
+	// ARRANGE
+	ft := New()
+	ft.Start()
+	ft.Set("foo", "default")
+
+	for _, ns := range []string{"one", "two"} {
+		req, err := http.NewRequest("PUT", ft.URL+"/foo.json?ns="+ns, strings.NewReader(`"`+ns+`"`))
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+		require.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// ACT & ASSERT
+	for _, ns := range []string{"one", "two"} {
+		req, err := http.NewRequest("GET", ft.URL+"/foo.json?ns="+ns, nil)
+		require.NoError(t, err)
+		resp := httptest.NewRecorder()
+		ft.serveHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.JSONEq(t, `"`+ns+`"`, resp.Body.String())
+	}
+	assert.Equal(t, "default", ft.Get("foo"))
+}
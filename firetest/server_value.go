@@ -0,0 +1,70 @@
+package firetest
+
+import (
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const serverValueKey = ".sv"
+
+// resolveServerValues replaces the server value placeholders found in v,
+// which is about to be written at the given path, with their actual values.
+// db.mtx must be held until v is written.
+//
+// Reference https://firebase.google.com/docs/reference/rest/database#section-server-values
+func (db *notifyDB) resolveServerValues(path string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if sv, ok := val[serverValueKey]; ok && len(val) == 1 {
+			return db.serverValue(path, sv)
+		}
+		for k, child := range val {
+			childPath := sanitizePath(path + "/" + k)
+			if k == ".value" {
+				// the value of a location that has a priority
+				childPath = path
+			}
+			val[k] = db.resolveServerValues(childPath, child)
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = db.resolveServerValues(sanitizePath(path+"/"+strconv.Itoa(i)), child)
+		}
+	}
+	return v
+}
+
+func (db *notifyDB) serverValue(path string, sv interface{}) interface{} {
+	switch sv := sv.(type) {
+	case string:
+		if sv == "timestamp" {
+			return float64(time.Now().UnixNano() / int64(time.Millisecond))
+		}
+	case map[string]interface{}:
+		if delta, ok := sv["increment"].(float64); ok {
+			var current interface{}
+			if n := db.intDB.Get(path); n != nil {
+				current = n.Objectify()
+			}
+			return toFloat(current) + delta
+		}
+	}
+
+	// unknown server value, store it as is
+	return map[string]interface{}{serverValueKey: sv}
+}
+
+// toFloat converts numeric values into a float64, anything
+// else is treated as if it were 0.
+func toFloat(v interface{}) float64 {
+	switch val := reflect.ValueOf(v); val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint())
+	case reflect.Float32, reflect.Float64:
+		return val.Float()
+	}
+	return 0
+}
@@ -0,0 +1,71 @@
+package firetest
+
+import (
+	"net/http"
+	"strings"
+	_sync "sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveServerValues(t *testing.T) {
+	ft := New()
+	ft.Set("counters/visits", 10)
+	ft.Set("counters/name", "not a number")
+
+	before := float64(time.Now().UnixNano() / int64(time.Millisecond))
+	v := ft.db.resolveServerValues("counters", map[string]interface{}{
+		"visits":  map[string]interface{}{".sv": map[string]interface{}{"increment": float64(5)}},
+		"name":    map[string]interface{}{".sv": map[string]interface{}{"increment": float64(1)}},
+		"new":     map[string]interface{}{".sv": map[string]interface{}{"increment": float64(2)}},
+		"list":    []interface{}{map[string]interface{}{".sv": "timestamp"}},
+		"unknown": map[string]interface{}{".sv": "foo"},
+	})
+
+	m, ok := v.(map[string]interface{})
+	if !assert.True(t, ok, "resolved value is not a map") {
+		return
+	}
+	assert.Equal(t, float64(15), m["visits"])
+	assert.Equal(t, float64(1), m["name"])
+	assert.Equal(t, float64(2), m["new"])
+	assert.Equal(t, map[string]interface{}{".sv": "foo"}, m["unknown"])
+
+	list := m["list"].([]interface{})
+	assert.True(t, list[0].(float64) >= before)
+}
+
+func TestConcurrentIncrements(t *testing.T) {
+	ft := New()
+	ft.Start()
+	defer ft.Close()
+
+	const n = 100
+	increment := `{".sv":{"increment":1}}`
+	var wg _sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(3)
+		for _, r := range []struct{ method, path, body string }{
+			{"PUT", "/counters/put.json", increment},
+			{"PATCH", "/counters.json", `{"patch":` + increment + `}`},
+			{"POST", "/counters/posts.json", `{"count":` + increment + `}`},
+		} {
+			go func(method, path, body string) {
+				defer wg.Done()
+				req, err := http.NewRequest(method, ft.URL+path, strings.NewReader(body))
+				require.NoError(t, err)
+				resp, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				resp.Body.Close()
+			}(r.method, r.path, r.body)
+		}
+	}
+	wg.Wait()
+
+	// every increment counts
+	assert.Equal(t, float64(n), ft.Get("counters/put"))
+	assert.Equal(t, float64(n), ft.Get("counters/patch"))
+}
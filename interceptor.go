@@ -0,0 +1,57 @@
+package firego
+
+import "net/http"
+
+// RoundTripFunc executes a single HTTP request and returns its response.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+// Interceptor wraps every request made by a Firebase reference, including
+// the streaming requests made when watching. It can inspect or modify the
+// request before calling next, inspect the response next returns, or
+// short-circuit the request by returning a response of its own, in which
+// case the response Body must not be nil.
+type Interceptor func(req *http.Request, next RoundTripFunc) (*http.Response, error)
+
+// Use appends the given interceptors to the chain of the reference.
+// Interceptors run in the order they were added, so the first one
+// sees the request first and the response last. References created
+// from this one start with a copy of its chain.
+func (fb *Firebase) Use(interceptors ...Interceptor) {
+	fb.configMtx.Lock()
+	fb.interceptors = append(fb.interceptors, interceptors...)
+	fb.streams = newStreamManager()
+	fb.configMtx.Unlock()
+}
+
+func withHeader(key, value string) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		req.Header.Add(key, value)
+		return next(req)
+	}
+}
+
+func withParam(key, value string) Interceptor {
+	return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		q := req.URL.Query()
+		q.Set(key, value)
+		req.URL.RawQuery = q.Encode()
+		return next(req)
+	}
+}
+
+// do sends the request through the given interceptors followed
+// by the chain of the reference and finally the http.Client.
+func (fb *Firebase) do(req *http.Request, interceptors ...Interceptor) (*http.Response, error) {
+	fb.configMtx.RLock()
+	chain := append(interceptors[:len(interceptors):len(interceptors)], fb.interceptors...)
+	fb.configMtx.RUnlock()
+
+	next := RoundTripFunc(fb.client.Do)
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, n := chain[i], next
+		next = func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, n)
+		}
+	}
+	return next(req)
+}
@@ -0,0 +1,106 @@
+package firego
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestUse(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+			calls = append(calls, name+" before")
+			req.Header.Add("X-Chain", name)
+			resp, err := next(req)
+			calls = append(calls, name+" after")
+			return resp, err
+		}
+	}
+
+	fb := New(server.URL, nil)
+	fb.Use(record("first"), record("second"))
+
+	require.NoError(t, fb.Set(true))
+	assert.Equal(t, []string{"first before", "second before", "second after", "first after"}, calls)
+
+	require.Len(t, server.receivedReqs, 1)
+	assert.Equal(t, []string{"first", "second"}, server.receivedReqs[0].Header["X-Chain"])
+}
+
+func TestUseCopiedToChildren(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	var parentCalls, childCalls int
+	fb := New(server.URL, nil)
+	fb.Use(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		parentCalls++
+		return next(req)
+	})
+
+	child := fb.Child("foo")
+	child.Use(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		childCalls++
+		return next(req)
+	})
+
+	require.NoError(t, child.Set(true))
+	assert.Equal(t, 1, parentCalls)
+	assert.Equal(t, 1, childCalls)
+
+	require.NoError(t, fb.Set(true))
+	assert.Equal(t, 2, parentCalls)
+	assert.Equal(t, 1, childCalls)
+}
+
+func TestUseShortCircuit(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.Use(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`"cached"`)),
+		}, nil
+	})
+
+	var v string
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, "cached", v)
+	assert.Len(t, server.receivedReqs, 0)
+}
+
+func TestUseWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	var accept string
+	fb := New(server.URL, nil)
+	fb.Use(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		accept = req.Header.Get("Accept")
+		return next(req)
+	})
+
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	<-notifications
+	fb.StopWatching()
+
+	assert.Equal(t, "text/event-stream", accept)
+}
@@ -0,0 +1,89 @@
+/*
+Package pushid generates keys in the same format Firebase uses for
+the children created by a push.
+
+A key is made of 20 characters, the first 8 encode the time it was
+generated at, in milliseconds, and the remaining 12 are random. Keys
+sort in the order they were generated, even when several of them are
+generated within the same millisecond.
+
+Reference https://firebase.googleblog.com/2015/02/the-2120-ways-to-ensure-unique_68.html
+*/
+package pushid
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// pushChars are the characters used in keys, ordered by their ASCII value
+const pushChars = "-0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_abcdefghijklmnopqrstuvwxyz"
+
+// Generator generates keys, its zero value is ready to use.
+type Generator struct {
+	mtx sync.Mutex
+
+	// now returns the current time, time.Now is used when nil
+	now func() time.Time
+
+	lastTime  int64
+	lastRands [12]byte
+}
+
+var defaultGenerator Generator
+
+// New generates a new key.
+func New() string {
+	return defaultGenerator.New()
+}
+
+// New generates a new key.
+func (g *Generator) New() string {
+	now := time.Now
+	if g.now != nil {
+		now = g.now
+	}
+	ms := now().UnixNano() / int64(time.Millisecond)
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	// a clock going backwards is treated as if it stood still
+	// so that keys never sort before the previous ones
+	duplicate := ms <= g.lastTime
+	if duplicate {
+		ms = g.lastTime
+	}
+	g.lastTime = ms
+
+	var id [20]byte
+	for i := 7; i >= 0; i-- {
+		id[i] = pushChars[ms%64]
+		ms /= 64
+	}
+
+	if duplicate {
+		// same millisecond as the previous key, increment the
+		// random part to make sure this key sorts after it
+		i := len(g.lastRands) - 1
+		for ; i >= 0 && g.lastRands[i] == 63; i-- {
+			g.lastRands[i] = 0
+		}
+		if i >= 0 {
+			g.lastRands[i]++
+		}
+	} else {
+		if _, err := rand.Read(g.lastRands[:]); err != nil {
+			panic("pushid: failed to read random bytes: " + err.Error())
+		}
+		for i := range g.lastRands {
+			g.lastRands[i] %= 64
+		}
+	}
+
+	for i, r := range g.lastRands {
+		id[8+i] = pushChars[r]
+	}
+	return string(id[:])
+}
@@ -0,0 +1,68 @@
+package pushid
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = New()
+		assert.Len(t, ids[i], 20)
+	}
+
+	assert.True(t, sort.StringsAreSorted(ids), "ids are not sorted")
+	seen := map[string]bool{}
+	for _, id := range ids {
+		assert.False(t, seen[id], "duplicate id %s", id)
+		seen[id] = true
+	}
+}
+
+func TestGeneratorTimestamp(t *testing.T) {
+	for _, test := range []struct {
+		ms       int64
+		expected string
+	}{
+		{ms: 1, expected: "-------0"},
+		{ms: 63, expected: "-------z"},
+		{ms: 64, expected: "------0-"},
+		{ms: 1500000000000, expected: "-KoyxtV-"},
+	} {
+		g := Generator{now: func() time.Time {
+			return time.Unix(0, test.ms*int64(time.Millisecond))
+		}}
+		assert.Equal(t, test.expected, g.New()[:8], "%d", test.ms)
+	}
+}
+
+func TestGeneratorSameMillisecond(t *testing.T) {
+	g := Generator{now: func() time.Time {
+		return time.Unix(1500000000, 0)
+	}}
+	first := g.New()
+
+	// force the random part to overflow its last character
+	g.lastRands[11] = 63
+	second := g.New()
+
+	assert.Equal(t, first[:8], second[:8])
+	assert.True(t, second > first)
+	assert.Equal(t, byte('-'), second[19])
+	assert.True(t, g.New() > second)
+}
+
+func TestGeneratorClockGoingBackwards(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	g := Generator{now: func() time.Time {
+		return now
+	}}
+	first := g.New()
+
+	now = now.Add(-time.Hour)
+	assert.True(t, g.New() > first)
+}
@@ -0,0 +1,124 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	_url "net/url"
+	"strings"
+)
+
+// MultiUpdate collects writes to different locations of the same database
+// and applies them atomically with a single request: either all of them
+// succeed or none of them do. The zero value is ready to use.
+//
+// Reference https://firebase.google.com/docs/database/rest/save-data#section-update-multiple
+type MultiUpdate struct {
+	refs   []*Firebase
+	values []interface{}
+}
+
+// Set queues a write of v to the location of the given reference.
+func (u *MultiUpdate) Set(ref *Firebase, v interface{}) *MultiUpdate {
+	u.refs = append(u.refs, ref)
+	u.values = append(u.values, v)
+	return u
+}
+
+// Remove queues the removal of the location of the given reference.
+func (u *MultiUpdate) Remove(ref *Firebase) *MultiUpdate {
+	return u.Set(ref, nil)
+}
+
+// Commit applies all the queued writes.
+func (u *MultiUpdate) Commit() error {
+	return u.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit but the request is bound to the given context.
+func (u *MultiUpdate) CommitContext(ctx context.Context) error {
+	ref, values, err := u.build()
+	if err != nil {
+		return err
+	}
+	return ref.UpdateContext(ctx, values)
+}
+
+// build computes the closest common ancestor of the queued locations and
+// returns a reference to it along with the values keyed by their path
+// relative to the ancestor.
+func (u *MultiUpdate) build() (*Firebase, map[string]interface{}, error) {
+	if len(u.refs) == 0 {
+		return nil, nil, errors.New("no writes to commit")
+	}
+
+	var root, db string
+	paths := make([][]string, len(u.refs))
+	for i, ref := range u.refs {
+		if ref.err != nil {
+			return nil, nil, ref.err
+		}
+		parsedURL, err := _url.Parse(ref.url)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// the namespace tells apart the databases served by the same host
+		r := parsedURL.Scheme + "://" + parsedURL.Host
+		ref.paramsMtx.RLock()
+		d := r + "?" + nsParam + "=" + ref.params.Get(nsParam)
+		ref.paramsMtx.RUnlock()
+		if i == 0 {
+			root, db = r, d
+		} else if d != db {
+			return nil, nil, fmt.Errorf("%s and %s do not belong to the same database", db, d)
+		}
+
+		if p := strings.Trim(parsedURL.Path, "/"); p != "" {
+			paths[i] = strings.Split(p, "/")
+		}
+	}
+
+	// the ancestor is the longest prefix shared by all the
+	// paths, excluding the paths themselves
+	ancestor := paths[0]
+	for _, p := range paths {
+		if len(p) <= len(ancestor) {
+			ancestor = p[:len(p):len(p)]
+		}
+	}
+	if len(ancestor) == 0 {
+		return nil, nil, errors.New("cannot include the root of the database in a multi-location update")
+	}
+	ancestor = ancestor[:len(ancestor)-1]
+	for _, p := range paths {
+		for i := range ancestor {
+			if p[i] != ancestor[i] {
+				ancestor = ancestor[:i]
+				break
+			}
+		}
+	}
+
+	values := make(map[string]interface{}, len(paths))
+	for i, p := range paths {
+		rel := strings.Join(p[len(ancestor):], "/")
+		for other := range values {
+			if strings.HasPrefix(rel+"/", other+"/") || strings.HasPrefix(other+"/", rel+"/") {
+				return nil, nil, fmt.Errorf("%s and %s overlap", other, rel)
+			}
+		}
+		values[rel] = u.values[i]
+	}
+
+	// the parameters shaping the data read mean nothing to a write
+	ref := u.refs[0].copy()
+	for _, p := range append(filterParams, shallowParam, formatParam) {
+		ref.params.Del(p)
+	}
+	ref.url = root
+	for _, key := range ancestor {
+		ref.url += "/" + _url.PathEscape(key)
+	}
+	return ref, values, nil
+}
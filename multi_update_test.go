@@ -0,0 +1,131 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestMultiUpdate(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.Set("users/alice", map[string]interface{}{"name": "Alice", "posts": 1})
+	server.Set("posts/old", "to be removed")
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Child("users").Watch(notifications))
+	<-notifications // initial data
+	defer fb.Child("users").StopWatching()
+
+	var u MultiUpdate
+	err := u.Set(fb.Child("users/alice/posts"), 2).
+		Set(fb.Child("users/bob"), map[string]interface{}{"name": "Bob"}).
+		Set(fb.Child("posts/new"), "hello").
+		Remove(fb.Child("posts/old")).
+		Commit()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"users": map[string]interface{}{
+			"alice": map[string]interface{}{"name": "Alice", "posts": float64(2)},
+			"bob":   map[string]interface{}{"name": "Bob"},
+		},
+		"posts": map[string]interface{}{"new": "hello"},
+	}, server.Get(""))
+
+	select {
+	case event := <-notifications:
+		assert.Equal(t, EventTypePatch, event.Type)
+		assert.Equal(t, "/", event.Path)
+		assert.Equal(t, map[string]interface{}{
+			"alice/posts": float64(2),
+			"bob":         map[string]interface{}{"name": "Bob"},
+		}, event.Data)
+	case <-time.After(time.Second):
+		require.FailNow(t, "did not receive a notification")
+	}
+}
+
+func TestMultiUpdateAncestor(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+	fb.Auth(authToken)
+
+	var u MultiUpdate
+	ref, values, err := u.Set(fb.Child("a/b/c"), 1).Set(fb.Child("a/b/d/e"), 2).build()
+	require.NoError(t, err)
+	assert.Equal(t, URL+"/a/b", ref.url)
+	assert.Equal(t, authToken, ref.params.Get(authParam))
+	assert.Equal(t, map[string]interface{}{"c": 1, "d/e": 2}, values)
+
+	u = MultiUpdate{}
+	query := fb.Child("a/b/c").OrderBy("name").StartAt("a").LimitToFirst(1)
+	query.Shallow(true)
+	query.IncludePriority(true)
+	ref, _, err = u.Set(query, 1).Set(fb.Child("a/d"), 2).build()
+	require.NoError(t, err)
+	assert.Equal(t, authParam+"="+authToken, ref.params.Encode())
+
+	u = MultiUpdate{}
+	ref, values, err = u.Set(fb.Child("a/b"), 1).build()
+	require.NoError(t, err)
+	assert.Equal(t, URL+"/a", ref.url)
+	assert.Equal(t, map[string]interface{}{"b": 1}, values)
+
+	u = MultiUpdate{}
+	ref, values, err = u.Set(fb.Child("a"), 1).Set(fb.Child("b/c"), 2).build()
+	require.NoError(t, err)
+	assert.Equal(t, URL, ref.url)
+	assert.Equal(t, map[string]interface{}{"a": 1, "b/c": 2}, values)
+}
+
+func TestMultiUpdateInvalid(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+
+	testCases := map[string]*MultiUpdate{
+		"empty":          {},
+		"root":           new(MultiUpdate).Set(fb, 1),
+		"different root": new(MultiUpdate).Set(fb.Child("a"), 1).Set(New("https://other.firebaseio.com", nil).Child("b"), 2),
+		"different namespace": new(MultiUpdate).
+			Set(NewWithOptions(URL, WithNamespace("a")).Child("x/y"), 1).
+			Set(NewWithOptions(URL, WithNamespace("b")).Child("x/z"), 2),
+		"duplicate": new(MultiUpdate).Set(fb.Child("a/b"), 1).Set(fb.Child("a/b"), 2),
+		"overlap":   new(MultiUpdate).Set(fb.Child("a/b"), 1).Set(fb.Child("a/b/c"), 2),
+	}
+	for name, u := range testCases {
+		assert.Error(t, u.Commit(), name)
+	}
+}
+
+func TestMultiUpdateNamespaces(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	a := NewWithOptions(server.URL, WithNamespace("a"))
+	b := NewWithOptions(server.URL, WithNamespace("b"))
+
+	var u MultiUpdate
+	err := u.Set(a.Child("x/y"), 1).Set(b.Child("x/z"), 2).Commit()
+	assert.Error(t, err)
+
+	var v interface{}
+	require.NoError(t, a.Child("x").Value(&v))
+	assert.Nil(t, v)
+
+	u = MultiUpdate{}
+	require.NoError(t, u.Set(b.Child("x/y"), 1).Set(b.Child("x/z"), 2).Commit())
+	require.NoError(t, b.Child("x").Value(&v))
+	assert.Equal(t, map[string]interface{}{"y": float64(1), "z": float64(2)}, v)
+	require.NoError(t, a.Child("x").Value(&v))
+	assert.Nil(t, v)
+}
@@ -0,0 +1,106 @@
+package firego
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// Option configures a Firebase reference created with NewWithOptions.
+// Every option is carried over to the references created from it.
+type Option func(*Firebase)
+
+// Logger is used to report diagnostic messages, such as rules debugging
+// information sent by Firebase. *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithHTTPClient sets the http.Client used to talk to Firebase. When a
+// client is given, WithTimeout and WithRedirectLimit have no effect
+// since the client is used as is.
+func WithHTTPClient(client *http.Client) Option {
+	return func(fb *Firebase) {
+		fb.client = client
+	}
+}
+
+// WithTimeout sets the length of time any request will have to establish
+// a connection and receive headers from Firebase before returning an
+// ErrTimeout error. Defaults to TimeoutDuration.
+func WithTimeout(d time.Duration) Option {
+	return func(fb *Firebase) {
+		fb.clientTimeout = d
+	}
+}
+
+// WithHeartbeat sets how long a connection that is watching a location
+// can go without hearing from Firebase before it is considered dead.
+// Defaults to 2 minutes.
+func WithHeartbeat(d time.Duration) Option {
+	return func(fb *Firebase) {
+		fb.watchHeartbeat = d
+	}
+}
+
+// WithRedirectLimit sets the maximum number of consecutive redirects
+// a request will follow. Defaults to 30.
+func WithRedirectLimit(n int) Option {
+	return func(fb *Firebase) {
+		fb.redirectLimit = n
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry failed requests.
+func WithRetryPolicy(p *RetryPolicy) Option {
+	return func(fb *Firebase) {
+		fb.retryPolicy = p
+	}
+}
+
+// WithReconnectPolicy sets the policy used to reconnect listeners,
+// Watch only reconnects when given one.
+func WithReconnectPolicy(p *ReconnectPolicy) Option {
+	return func(fb *Firebase) {
+		fb.reconnectPolicy = p
+	}
+}
+
+// WithLogger sets the logger used to report diagnostic messages.
+// Defaults to the standard logger of the log package.
+func WithLogger(l Logger) Option {
+	return func(fb *Firebase) {
+		fb.logger = l
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(ua string) Option {
+	return func(fb *Firebase) {
+		fb.userAgent = ua
+	}
+}
+
+// WithTokenSource sets the source of the tokens used to authenticate
+// to Firebase. The tokens take precedence over the one given to Auth.
+func WithTokenSource(src TokenSource) Option {
+	return func(fb *Firebase) {
+		fb.tokens = newTokenCache(src)
+	}
+}
+
+// WithInterceptors appends the given interceptors to the chain of the
+// reference, see Firebase.Use.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(fb *Firebase) {
+		fb.Use(interceptors...)
+	}
+}
+
+func (fb *Firebase) logf(format string, v ...interface{}) {
+	if fb.logger == nil {
+		log.Printf(format, v...)
+		return
+	}
+	fb.logger.Printf(format, v...)
+}
@@ -0,0 +1,126 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, format)
+}
+
+func TestNewWithOptions(t *testing.T) {
+	t.Parallel()
+	var (
+		policy    = &RetryPolicy{MaxAttempts: 3}
+		reconnect = &ReconnectPolicy{MaxBackoff: time.Second}
+		logger    = &testLogger{}
+		tokens    = StaticTokenSource(&Token{Value: "token"})
+	)
+
+	fb := NewWithOptions(URL+"/",
+		WithTimeout(time.Second),
+		WithHeartbeat(time.Minute),
+		WithRedirectLimit(3),
+		WithRetryPolicy(policy),
+		WithReconnectPolicy(reconnect),
+		WithLogger(logger),
+		WithUserAgent("firego-test"),
+		WithTokenSource(tokens),
+	)
+	assert.Equal(t, URL, fb.url)
+
+	ref, err := fb.Ref("foo")
+	require.NoError(t, err)
+	refs := map[string]*Firebase{
+		"root":     fb,
+		"child":    fb.Child("foo"),
+		"ref":      ref,
+		"query":    fb.OrderBy("foo").LimitToFirst(2),
+		"grandkid": fb.Child("foo").Child("bar").EqualTo("baz"),
+		"parent":   fb.Child("foo/bar").Parent(),
+		"new root": fb.Child("foo").Root(),
+	}
+	for name, ref := range refs {
+		assert.Equal(t, fb.client, ref.client, name)
+		assert.Equal(t, time.Second, ref.clientTimeout, name)
+		assert.Equal(t, time.Minute, ref.watchHeartbeat, name)
+		assert.Equal(t, 3, ref.redirectLimit, name)
+		assert.Equal(t, policy, ref.retryPolicy, name)
+		assert.Equal(t, reconnect, ref.reconnectPolicy, name)
+		assert.Equal(t, logger, ref.logger, name)
+		assert.Equal(t, "firego-test", ref.userAgent, name)
+		assert.NotNil(t, ref.tokens, name)
+	}
+}
+
+func TestWithUserAgent(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := NewWithOptions(server.URL, WithUserAgent("firego-test"))
+	require.NoError(t, fb.Set(true))
+
+	require.Len(t, server.receivedReqs, 1)
+	assert.Equal(t, "firego-test", server.receivedReqs[0].UserAgent())
+}
+
+func TestWithRedirectLimit(t *testing.T) {
+	t.Parallel()
+	redirects := new(int64)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt64(redirects, 1)
+		http.Redirect(w, req, server.URL+req.URL.String(), http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	fb := NewWithOptions(server.URL, WithRedirectLimit(2))
+	err := fb.Set(true)
+	assert.Error(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt64(redirects))
+}
+
+func TestWithTokenSource(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	server.RequireAuth(true)
+
+	calls := new(int64)
+	fb := NewWithOptions(server.URL, WithTokenSource(TokenSourceFunc(func(context.Context) (*Token, error) {
+		atomic.AddInt64(calls, 1)
+		return &Token{Value: server.Secret}, nil
+	})))
+
+	// the source takes precedence over static tokens
+	fb.Auth("bad-token")
+	require.NoError(t, fb.Child("foo").Set(true))
+
+	var v bool
+	require.NoError(t, fb.Child("foo").Value(&v))
+	assert.True(t, v)
+	assert.EqualValues(t, 1, atomic.LoadInt64(calls))
+
+	expected := errors.New("no token for you")
+	fb = NewWithOptions(server.URL, WithTokenSource(TokenSourceFunc(func(context.Context) (*Token, error) {
+		return nil, expected
+	})))
+	assert.Equal(t, expected, fb.Set(true))
+}
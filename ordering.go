@@ -0,0 +1,169 @@
+package firego
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+// orderBy values with a special meaning, besides priorityOrder
+const (
+	keyOrder   = "$key"
+	valueOrder = "$value"
+)
+
+// ordering sorts the children of a location the way Firebase sorts the
+// results of a query. It holds the orderBy parameter of the query, the
+// empty ordering sorts children by priority like Firebase does when
+// no order is given.
+//
+// Reference https://firebase.google.com/docs/database/rest/retrieve-data#section-rest-ordered-data
+type ordering string
+
+// ordering returns the ordering of the reference's query.
+func (fb *Firebase) ordering() ordering {
+	fb.paramsMtx.RLock()
+	orderBy := fb.params.Get(orderByParam)
+	fb.paramsMtx.RUnlock()
+
+	var o string
+	if err := json.Unmarshal([]byte(orderBy), &o); err != nil {
+		o = orderBy
+	}
+	return ordering(o)
+}
+
+// value returns the value n is sorted by, besides its key.
+func (o ordering) value(n *sync.Node) interface{} {
+	switch o {
+	case "", priorityOrder:
+		return n.Priority
+	case keyOrder:
+		return nil
+	case valueOrder:
+		return n.Objectify()
+	}
+
+	child, ok := n.Child(string(o))
+	if !ok {
+		return nil
+	}
+	return child.Objectify()
+}
+
+// compare returns a negative number when a sorts before b, a positive
+// one when it sorts after it and 0 when both nodes have the same key.
+func (o ordering) compare(a, b *sync.Node) int {
+	if c := compareValues(o.value(a), o.value(b)); c != 0 {
+		return c
+	}
+	return compareKeys(a.Key, b.Key)
+}
+
+// compareKeys sorts keys that are 32-bit integers numerically
+// before any other key, which are sorted lexicographically.
+func compareKeys(a, b string) int {
+	i, aIsInt := keyInt(a)
+	j, bIsInt := keyInt(b)
+	switch {
+	case aIsInt && bIsInt:
+		if i != j {
+			return compareFloats(float64(i), float64(j))
+		}
+		// "01" comes after "1"
+		return len(a) - len(b)
+	case aIsInt:
+		return -1
+	case bIsInt:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func keyInt(key string) (int64, bool) {
+	if key == "" || key[0] == '+' {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(key, 10, 32)
+	return i, err == nil
+}
+
+// compareValues sorts null values first, followed by false, true,
+// numbers in ascending order, strings lexicographically and finally
+// objects, which are considered equal to each other.
+func compareValues(a, b interface{}) int {
+	ra, rb := valueRank(a), valueRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch ra {
+	case rankNumber:
+		x, _ := number(a)
+		y, _ := number(b)
+		return compareFloats(x, y)
+	case rankString:
+		return strings.Compare(a.(string), b.(string))
+	}
+	return 0
+}
+
+// ranks of the different kinds of values, in the order they are sorted
+const (
+	rankNull = iota
+	rankFalse
+	rankTrue
+	rankNumber
+	rankString
+	rankObject
+)
+
+func valueRank(v interface{}) int {
+	if v == nil {
+		return rankNull
+	}
+	if b, ok := v.(bool); ok {
+		if b {
+			return rankTrue
+		}
+		return rankFalse
+	}
+	if _, ok := number(v); ok {
+		return rankNumber
+	}
+	if _, ok := v.(string); ok {
+		return rankString
+	}
+	return rankObject
+}
+
+// number converts numeric values into a float64.
+func number(v interface{}) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+
+	switch val := reflect.ValueOf(v); val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	}
+	return 0, false
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
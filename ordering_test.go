@@ -0,0 +1,83 @@
+package firego
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zabawaba99/firego/sync"
+)
+
+func TestCompareKeys(t *testing.T) {
+	t.Parallel()
+	keys := []string{"b", "a", "10", "-5", "2", "02", "+3", "A", "2147483648", "-"}
+	sort.Slice(keys, func(i, j int) bool {
+		return compareKeys(keys[i], keys[j]) < 0
+	})
+	assert.Equal(t, []string{"-5", "2", "02", "10", "+3", "-", "2147483648", "A", "a", "b"}, keys)
+}
+
+func TestCompareValues(t *testing.T) {
+	t.Parallel()
+	values := []interface{}{
+		map[string]interface{}{"a": 1},
+		"b",
+		"a",
+		json.Number("2.5"),
+		float64(10),
+		1,
+		true,
+		false,
+		nil,
+	}
+	sort.SliceStable(values, func(i, j int) bool {
+		return compareValues(values[i], values[j]) < 0
+	})
+	assert.Equal(t, []interface{}{
+		nil,
+		false,
+		true,
+		1,
+		json.Number("2.5"),
+		float64(10),
+		"a",
+		"b",
+		map[string]interface{}{"a": 1},
+	}, values)
+}
+
+func TestOrdering(t *testing.T) {
+	t.Parallel()
+	nodes := map[string]*sync.Node{}
+	for k, v := range map[string]interface{}{
+		"a": map[string]interface{}{"score": float64(3), "info": map[string]interface{}{"age": float64(1)}, ".priority": "z"},
+		"b": map[string]interface{}{"score": float64(1), ".priority": float64(2)},
+		"c": map[string]interface{}{"info": map[string]interface{}{"age": float64(0)}},
+		"1": map[string]interface{}{"score": float64(1), ".priority": float64(2)},
+	} {
+		nodes[k] = sync.NewNode(k, v)
+	}
+
+	tests := map[string][]string{
+		"":          {"c", "1", "b", "a"},
+		"$priority": {"c", "1", "b", "a"},
+		"$key":      {"1", "a", "b", "c"},
+		"$value":    {"1", "a", "b", "c"},
+		"score":     {"c", "1", "b", "a"},
+		"info/age":  {"1", "b", "c", "a"},
+	}
+	for orderBy, expected := range tests {
+		fb := New(URL, nil)
+		if orderBy != "" {
+			fb = fb.OrderBy(orderBy)
+		}
+		order := fb.ordering()
+
+		keys := []string{"a", "b", "c", "1"}
+		sort.Slice(keys, func(i, j int) bool {
+			return order.compare(nodes[keys[i]], nodes[keys[j]]) < 0
+		})
+		assert.Equal(t, expected, keys, orderBy)
+	}
+}
@@ -0,0 +1,171 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	_url "net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// limits enforced by Firebase on the locations of a database
+//
+// Reference https://firebase.google.com/docs/database/usage/limits#data_tree
+const (
+	maxKeyBytes = 768
+	maxDepth    = 32
+)
+
+// ErrInvalidPath matches errors returned when a path, or a key of the
+// data being written, is not accepted by Firebase.
+var ErrInvalidPath = errors.New("invalid path")
+
+// InvalidPathError is returned when a path, or a key of the data being
+// written, is not accepted by Firebase. References created with Child
+// from an invalid path return it from every operation.
+type InvalidPathError struct {
+	// Path is the offending path, relative to the reference
+	// when it comes from the data being written.
+	Path string
+	// Reason describes what is wrong with the path.
+	Reason string
+}
+
+func (e *InvalidPathError) Error() string {
+	return fmt.Sprintf("invalid path %q: %s", e.Path, e.Reason)
+}
+
+// Is reports whether target is ErrInvalidPath.
+func (e *InvalidPathError) Is(target error) bool {
+	return target == ErrInvalidPath
+}
+
+// pathKeys are the keys with a special meaning that
+// can show up in the path of a reference
+var pathKeys = map[string]bool{
+	priorityKey: true,
+	".info":     true,
+}
+
+// invalidKey returns the reason why key cannot be used
+// in a Firebase database, or an empty string if it can.
+func invalidKey(key string) string {
+	switch {
+	case key == "":
+		return "keys cannot be empty"
+	case len(key) > maxKeyBytes:
+		return fmt.Sprintf("keys cannot be longer than %d bytes", maxKeyBytes)
+	case !utf8.ValidString(key):
+		return "keys must be valid UTF-8"
+	case strings.IndexFunc(key, illegalRune) >= 0:
+		return `keys cannot contain ".", "$", "#", "[", "]", "/" or control characters`
+	}
+	return ""
+}
+
+func illegalRune(r rune) bool {
+	return r < 0x20 || r == 0x7f || strings.ContainsRune(".$#[]/", r)
+}
+
+// escapePath validates the keys of the slash separated path, which is
+// to be appended to a location that is depth levels deep, and returns
+// it with its keys escaped for use in a URL.
+func escapePath(path string, depth int) (string, error) {
+	var keys []string
+	for _, key := range strings.Split(path, "/") {
+		if key == "" {
+			continue
+		}
+		if reason := invalidKey(key); reason != "" && !pathKeys[key] {
+			return "", &InvalidPathError{Path: path, Reason: reason}
+		}
+		keys = append(keys, _url.PathEscape(key))
+	}
+
+	if depth+len(keys) > maxDepth {
+		return "", &InvalidPathError{Path: path, Reason: fmt.Sprintf("locations cannot be more than %d levels deep", maxDepth)}
+	}
+	return strings.Join(keys, "/"), nil
+}
+
+// depth returns the number of levels between the root
+// of the database and the location of the reference.
+func (fb *Firebase) depth() int {
+	u, err := _url.Parse(fb.url)
+	if err != nil {
+		return 0
+	}
+	path := strings.Trim(u.Path, "/")
+	if path == "" {
+		return 0
+	}
+	return strings.Count(path, "/") + 1
+}
+
+// validateData makes sure the keys of the JSON encoded data about to be
+// written at a location depth levels deep are accepted by Firebase. The
+// keys of an update are allowed to be paths to deeper locations.
+func validateData(body []byte, depth int, update bool) error {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		// leave it to Firebase to reject
+		return nil
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !update || !ok {
+		return validateValue("", v, depth)
+	}
+	for path, child := range m {
+		escaped, err := escapePath(path, depth)
+		if err != nil {
+			return err
+		}
+		if err := validateValue(path, child, depth+strings.Count(escaped, "/")+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateValue(path string, v interface{}, depth int) error {
+	children := map[string]interface{}{}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		children = val
+	case []interface{}:
+		for i, child := range val {
+			children[strconv.Itoa(i)] = child
+		}
+	}
+
+	for key, child := range children {
+		switch key {
+		case serverValueKey, priorityKey:
+			continue
+		case valueKey:
+			// the value of a location that has a priority
+			if err := validateValue(path, child, depth); err != nil {
+				return err
+			}
+			continue
+		}
+
+		childPath := strings.TrimPrefix(path+"/"+key, "/")
+		if reason := invalidKey(key); reason != "" {
+			return &InvalidPathError{Path: childPath, Reason: reason}
+		}
+		if depth+1 > maxDepth {
+			return &InvalidPathError{Path: childPath, Reason: fmt.Sprintf("locations cannot be more than %d levels deep", maxDepth)}
+		}
+		if err := validateValue(childPath, child, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package firego
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestChildEscapesKeys(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+
+	tests := map[string]string{
+		"a b":        URL + "/a%20b",
+		"100%/?&":    URL + "/100%25/%3F&",
+		"some/deep":  URL + "/some/deep",
+		"/trim//me/": URL + "/trim/me",
+		"":           URL,
+		".priority":  URL + "/.priority",
+		"ünïcode":    URL + "/%C3%BCn%C3%AFcode",
+	}
+	for child, expected := range tests {
+		c := fb.Child(child)
+		assert.NoError(t, c.err, child)
+		assert.Equal(t, expected, c.url, child)
+	}
+	assert.Equal(t, "a b", fb.Child("a b").Key())
+}
+
+func TestChildInvalidPath(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+
+	for _, child := range []string{"a.b", "a#b", "a$b", "a[b", "a]b", "a\x00b", "a\x7fb", strings.Repeat("a", maxKeyBytes+1), strings.Repeat("a/", maxDepth+1)} {
+		c := fb.Child(child)
+		require.Error(t, c.err, child)
+
+		// the error sticks to the reference and the ones created from it
+		err := c.Child("valid").Set(true)
+		assert.True(t, errors.Is(err, ErrInvalidPath), child)
+		var pathErr *InvalidPathError
+		require.True(t, errors.As(err, &pathErr), child)
+		assert.Equal(t, child, pathErr.Path)
+		assert.Error(t, c.Watch(make(chan Event)), child)
+	}
+	assert.Nil(t, server.Get(""))
+
+	// the deepest location allowed
+	assert.NoError(t, fb.Child(strings.Repeat("a/", maxDepth)).err)
+	assert.NoError(t, fb.Child(strings.Repeat("a", maxKeyBytes)).err)
+}
+
+func TestRefInvalidPath(t *testing.T) {
+	t.Parallel()
+	fb := New(URL, nil)
+
+	ref, err := fb.Ref("users/a.b")
+	assert.True(t, errors.Is(err, ErrInvalidPath))
+	assert.Equal(t, err, ref.err)
+
+	// a valid path clears the error
+	ref, err = ref.Ref("users/a b")
+	require.NoError(t, err)
+	assert.NoError(t, ref.err)
+	assert.Equal(t, URL+"/users/a%20b", ref.url)
+}
+
+func TestValidateData(t *testing.T) {
+	t.Parallel()
+	deep := `1`
+	for i := 0; i < maxDepth; i++ {
+		deep = `{"a":` + deep + `}`
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		depth  int
+		update bool
+		valid  bool
+	}{
+		{name: "primitive", body: `"a.b"`, valid: true},
+		{name: "object", body: `{"a b":{"c%":1}}`, valid: true},
+		{name: "special keys", body: `{"a":{".sv":"timestamp"},".priority":1,"b":{".value":{"c":1},".priority":2}}`, valid: true},
+		{name: "illegal key", body: `{"a":{"b.c":1}}`},
+		{name: "illegal key in value", body: `{".value":{"$b":1}}`},
+		{name: "empty key", body: `{"":1}`},
+		{name: "illegal key in array", body: `[{"a#":1}]`},
+		{name: "slash in set", body: `{"a/b":1}`},
+		{name: "slash in update", body: `{"a/b":1,"c/.priority":2}`, update: true, valid: true},
+		{name: "illegal key in update path", body: `{"a/b.c":1}`, update: true},
+		{name: "illegal key in update value", body: `{"a/b":{"c]":1}}`, update: true},
+		{name: "deepest", body: deep, valid: true},
+		{name: "too deep", body: deep, depth: 1},
+		{name: "update too deep", body: `{"a/b":{"c":1}}`, depth: maxDepth - 2, update: true},
+	}
+	for _, test := range tests {
+		err := validateData([]byte(test.body), test.depth, test.update)
+		if test.valid {
+			assert.NoError(t, err, test.name)
+			continue
+		}
+		assert.True(t, errors.Is(err, ErrInvalidPath), test.name)
+	}
+}
+
+func TestEscapedKeys(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	fb := New(server.URL, nil)
+
+	require.NoError(t, fb.Child("a b/100%?").Set(true))
+	assert.Equal(t, true, server.Get("a b/100%?"))
+
+	var v map[string]interface{}
+	require.NoError(t, fb.Child("a b").Value(&v))
+	assert.Equal(t, map[string]interface{}{"100%?": true}, v)
+
+	err := fb.Child("a b").Set(map[string]interface{}{"c.d": true})
+	assert.True(t, errors.Is(err, ErrInvalidPath))
+	assert.Equal(t, map[string]interface{}{"100%?": true}, server.Get("a b"))
+}
@@ -0,0 +1,91 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+// keys used by the export format to hold the priority of a
+// location and the value of a location that has a priority
+const (
+	priorityKey   = ".priority"
+	valueKey      = ".value"
+	priorityOrder = "$priority"
+)
+
+// SetWithPriority sets the value of the Firebase reference along
+// with its priority.
+//
+// Reference https://firebase.google.com/docs/database/rest/app-management#section-priorities
+func (fb *Firebase) SetWithPriority(v interface{}, priority interface{}) error {
+	return fb.SetWithPriorityContext(context.Background(), v, priority)
+}
+
+// SetWithPriorityContext is like SetWithPriority but the request is bound
+// to the given context.
+func (fb *Firebase) SetWithPriorityContext(ctx context.Context, v interface{}, priority interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	p, err := json.Marshal(priority)
+	if err != nil {
+		return err
+	}
+
+	// objects carry their priority next to their children,
+	// anything else has to be wrapped
+	data := map[string]json.RawMessage{valueKey: value}
+	if value[0] == '{' {
+		data = map[string]json.RawMessage{}
+		if err := json.Unmarshal(value, &data); err != nil {
+			return err
+		}
+	}
+	data[priorityKey] = p
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, _, err = fb.doRequest(ctx, "PUT", body)
+	return err
+}
+
+// SetPriority sets the priority of the Firebase reference
+// leaving its value untouched.
+//
+// Reference https://firebase.google.com/docs/database/rest/app-management#section-priorities
+func (fb *Firebase) SetPriority(priority interface{}) error {
+	return fb.SetPriorityContext(context.Background(), priority)
+}
+
+// SetPriorityContext is like SetPriority but the request is bound
+// to the given context.
+func (fb *Firebase) SetPriorityContext(ctx context.Context, priority interface{}) error {
+	return fb.Child(priorityKey).SetContext(ctx, priority)
+}
+
+// Snapshot gets the value of the Firebase reference along with its priority.
+func (fb *Firebase) Snapshot() (DataSnapshot, error) {
+	return fb.SnapshotContext(context.Background())
+}
+
+// SnapshotContext is like Snapshot but the request is bound
+// to the given context.
+func (fb *Firebase) SnapshotContext(ctx context.Context) (DataSnapshot, error) {
+	_, bytes, err := fb.doRequest(ctx, "GET", nil, withParam(formatParam, formatVal))
+	if err != nil {
+		return DataSnapshot{}, err
+	}
+
+	var v interface{}
+	if len(bytes) > 0 {
+		if err := json.Unmarshal(bytes, &v); err != nil {
+			return DataSnapshot{}, err
+		}
+	}
+	return newSnapshot(sync.NewNode(fb.Key(), v)), nil
+}
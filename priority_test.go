@@ -0,0 +1,94 @@
+package firego
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestSetWithPriority(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	require.NoError(t, fb.Child("leaf").SetWithPriority("foo", 1))
+	require.NoError(t, fb.Child("object").SetWithPriority(map[string]interface{}{"bar": true}, "a"))
+
+	// priorities are hidden from regular reads
+	var v map[string]interface{}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, map[string]interface{}{
+		"leaf":   "foo",
+		"object": map[string]interface{}{"bar": true},
+	}, v)
+
+	snapshot, err := fb.Child("leaf").Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, DataSnapshot{Key: "leaf", Value: "foo", Priority: float64(1)}, snapshot)
+
+	snapshot, err = fb.Child("object").Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, DataSnapshot{Key: "object", Value: map[string]interface{}{"bar": true}, Priority: "a"}, snapshot)
+}
+
+func TestSetPriority(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("foo", "bar")
+
+	fb := New(server.URL+"/foo", nil)
+	require.NoError(t, fb.SetPriority(10))
+
+	snapshot, err := fb.Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, "bar", snapshot.Value)
+	assert.Equal(t, float64(10), snapshot.Priority)
+}
+
+func TestOrderByPriority(t *testing.T) {
+	t.Parallel()
+	var (
+		server = newTestServer("")
+		fb     = New(server.URL, nil)
+	)
+	defer server.Close()
+
+	fb.OrderByPriority().Value("")
+	require.Len(t, server.receivedReqs, 1)
+
+	req := server.receivedReqs[0]
+	assert.Equal(t, orderByParam+"=%22%24priority%22", req.URL.Query().Encode())
+}
+
+func TestChildAddedPriority(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("items/a", map[string]interface{}{".value": "foo", ".priority": 2.0})
+
+	fb := New(server.URL+"/items", nil)
+	fb.IncludePriority(true)
+
+	snapshots := make(chan DataSnapshot, 2)
+	fn := func(snapshot DataSnapshot, previousChildKey string) {
+		snapshots <- snapshot
+	}
+	sub, err := fb.ChildAdded(fn)
+	require.NoError(t, err)
+	defer sub.Cancel()
+
+	select {
+	case s := <-snapshots:
+		assert.Equal(t, DataSnapshot{Key: "a", Value: "foo", Priority: 2.0}, s)
+	case <-time.After(time.Second):
+		assert.Fail(t, "no child added")
+	}
+}
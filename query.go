@@ -232,6 +232,30 @@ func (fb *Firebase) Shallow(v bool) {
 	fb.paramsMtx.Unlock()
 }
 
+// OrderByPriority creates a new Firebase reference with the
+// results ordered by the priority of the children.
+//
+// Reference https://firebase.google.com/docs/database/rest/retrieve-data#section-rest-ordered-data
+func (fb *Firebase) OrderByPriority() *Firebase {
+	return fb.OrderBy(priorityOrder)
+}
+
+// Silent determines whether or not Firebase should send back the data
+// written by Set, Update and Remove. Silent writes are answered with
+// an empty response, which saves bandwidth when making lots of them.
+// Reads and Push are not affected since they need the response.
+//
+// Reference https://firebase.google.com/docs/database/rest/app-management#section-param-print
+func (fb *Firebase) Silent(v bool) {
+	fb.paramsMtx.Lock()
+	if v {
+		fb.params.Set(printParam, silentVal)
+	} else {
+		fb.params.Del(printParam)
+	}
+	fb.paramsMtx.Unlock()
+}
+
 // IncludePriority determines whether or not to ask Firebase
 // for the values priority. By default, the priority is not returned.
 //
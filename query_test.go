@@ -282,3 +282,33 @@ func TestEscapeParameter(t *testing.T) {
 		assert.Equal(t, testCase.expected, escapeParameter(testCase.value))
 	}
 }
+
+func TestSilent(t *testing.T) {
+	t.Parallel()
+	var (
+		server = newTestServer("")
+		fb     = New(server.URL, nil)
+	)
+	defer server.Close()
+
+	fb.Silent(true)
+	fb.Set("foo")
+	require.Len(t, server.receivedReqs, 1)
+
+	req := server.receivedReqs[0]
+	assert.Equal(t, printParam+"="+silentVal, req.URL.Query().Encode())
+
+	// reads need the response
+	fb.Value("")
+	require.Len(t, server.receivedReqs, 2)
+
+	req = server.receivedReqs[1]
+	assert.Equal(t, "", req.URL.Query().Encode())
+
+	fb.Silent(false)
+	fb.Set("foo")
+	require.Len(t, server.receivedReqs, 3)
+
+	req = server.receivedReqs[2]
+	assert.Equal(t, "", req.URL.Query().Encode())
+}
@@ -0,0 +1,183 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+const (
+	// EventTypeDisconnected is the event type sent, when watching with a
+	// ReconnectPolicy, once the connection is lost. The data of the event
+	// is the error that ended the connection.
+	EventTypeDisconnected = "disconnected"
+	// EventTypeReconnected is the event type sent, when watching with a
+	// ReconnectPolicy, once the connection is reestablished.
+	EventTypeReconnected = "reconnected"
+)
+
+const (
+	defaultReconnectInitialBackoff = time.Second
+	defaultReconnectMaxBackoff     = time.Minute
+)
+
+// ReconnectPolicy determines how connections watching a location are
+// reestablished once they are lost. A ReconnectPolicy should not be
+// modified once it has been given to a Firebase reference.
+type ReconnectPolicy struct {
+	// InitialBackoff is how long to wait before the first attempt to
+	// reconnect, every following attempt doubles the wait. Defaults to 1s.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps how long to wait between two attempts.
+	// Defaults to 1m.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of each backoff that is
+	// randomized so that clients do not reconnect in lockstep.
+	Jitter float64
+}
+
+// defaultReconnectPolicy is used by the listeners of the references
+// that were not given a ReconnectPolicy.
+var defaultReconnectPolicy = &ReconnectPolicy{Jitter: 0.2}
+
+// SetReconnectPolicy sets the policy used to reconnect the listeners of
+// this reference and every reference created from it. Watch only
+// reconnects when given a policy, a nil policy restores the default.
+func (fb *Firebase) SetReconnectPolicy(p *ReconnectPolicy) {
+	fb.configMtx.Lock()
+	fb.reconnectPolicy = p
+	fb.configMtx.Unlock()
+}
+
+// reconnects returns the policy given to the reference, if any.
+func (fb *Firebase) reconnects() *ReconnectPolicy {
+	fb.configMtx.RLock()
+	defer fb.configMtx.RUnlock()
+	return fb.reconnectPolicy
+}
+
+func (fb *Firebase) listenerPolicy() *ReconnectPolicy {
+	if p := fb.reconnects(); p != nil {
+		return p
+	}
+	return defaultReconnectPolicy
+}
+
+func (p *ReconnectPolicy) backoff(attempt int) time.Duration {
+	return backoff(attempt, p.InitialBackoff, p.MaxBackoff, defaultReconnectInitialBackoff, defaultReconnectMaxBackoff, p.Jitter)
+}
+
+// reconnecting passes on the events of the location, reconnecting as
+// many times as needed once the connection is lost. The returned
+// channel is closed after an EventTypeError event once the context is
+// done or Firebase refuses the connection.
+func (fb *Firebase) reconnecting(ctx context.Context, p *ReconnectPolicy, events chan Event) chan Event {
+	notifications := make(chan Event)
+	go func() {
+		defer close(notifications)
+
+		db := sync.NewDB()
+		resync := false
+		for {
+			var cause error = io.EOF
+			for event := range events {
+				switch event.Type {
+				case EventTypeError:
+					if ctx.Err() != nil {
+						notifications <- event
+						return
+					}
+					if err, ok := event.Data.(error); ok {
+						cause = err
+					}
+					continue
+				case EventTypePut, EventTypePatch:
+					if resync && event.Type == EventTypePut && event.Path == "/" {
+						// only pass on what changed while disconnected
+						var old interface{}
+						if n := db.Get(""); n != nil {
+							old = n.Export()
+						}
+						event.apply(db)
+						for _, change := range diffData("", old, event.Data) {
+							notifications <- change
+						}
+						resync = false
+						continue
+					}
+					event.apply(db)
+				}
+				resync = false
+				notifications <- event
+			}
+
+			notifications <- Event{Type: EventTypeDisconnected, Data: cause}
+			var err error
+			for attempt := 1; ; attempt++ {
+				if !sleepContext(ctx, p.backoff(attempt)) {
+					notifications <- Event{Type: EventTypeError, Data: requestError(ctx, ctx.Err())}
+					return
+				}
+				if events, err = fb.watch(ctx); err == nil {
+					break
+				}
+				if rejected(err) || errors.As(err, new(ErrCanceled)) {
+					notifications <- Event{Type: EventTypeError, Data: err}
+					return
+				}
+			}
+			notifications <- Event{Type: EventTypeReconnected}
+			resync = true
+		}
+	}()
+	return notifications
+}
+
+// diffData returns the puts turning the old data of the location
+// at path into the current one, changing as little data as possible.
+func diffData(path string, old, current interface{}) []Event {
+	if reflect.DeepEqual(old, current) {
+		return nil
+	}
+
+	oldChildren, oldIsObject := old.(map[string]interface{})
+	children, isObject := current.(map[string]interface{})
+	if !oldIsObject || !isObject || hasPriority(oldChildren) || hasPriority(children) {
+		return []Event{newEvent(EventTypePut, path, current)}
+	}
+
+	keys := make([]string, 0, len(oldChildren)+len(children))
+	for k := range oldChildren {
+		keys = append(keys, k)
+	}
+	for k := range children {
+		if _, ok := oldChildren[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var events []Event
+	for _, k := range keys {
+		childPath := k
+		if path != "" {
+			childPath = path + "/" + k
+		}
+		events = append(events, diffData(childPath, oldChildren[k], children[k])...)
+	}
+	return events
+}
+
+// hasPriority reports whether the object, in the export format,
+// carries a priority, which cannot be changed on its own.
+func hasPriority(obj map[string]interface{}) bool {
+	_, ok := obj[priorityKey]
+	return ok
+}
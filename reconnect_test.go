@@ -0,0 +1,209 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDroppingServer serves the given data to the connections watching it,
+// the first connection is dropped right after the data is sent while the
+// following ones stay open. Connections past the last data are refused.
+func newDroppingServer(data ...string) *httptest.Server {
+	var count = new(int64)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		i := int(atomic.AddInt64(count, 1)) - 1
+		if i >= len(data) {
+			http.Error(w, `{"error":"Permission denied"}`, http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: {\"path\":\"/\",\"data\":%s}\n\n", data[i])
+		w.(http.Flusher).Flush()
+		if i > 0 {
+			<-req.Context().Done()
+		}
+	}))
+}
+
+func readEvent(t *testing.T, notifications chan Event) Event {
+	select {
+	case event, ok := <-notifications:
+		require.True(t, ok, "notifications were closed")
+		return event
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out reading notification")
+	}
+	return Event{}
+}
+
+func TestWatchReconnect(t *testing.T) {
+	t.Parallel()
+	server := newDroppingServer(`{"a":1,"b":{"c":2},"e":true}`, `{"a":1,"b":{"c":3},"d":4}`)
+	defer server.Close()
+
+	fb := NewWithOptions(server.URL, WithReconnectPolicy(&ReconnectPolicy{InitialBackoff: 10 * time.Millisecond}))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	event := readEvent(t, notifications)
+	assert.Equal(t, EventTypePut, event.Type)
+	assert.Equal(t, "/", event.Path)
+
+	event = readEvent(t, notifications)
+	assert.Equal(t, EventTypeDisconnected, event.Type)
+	assert.Error(t, event.Data.(error))
+	assert.Equal(t, EventTypeReconnected, readEvent(t, notifications).Type)
+
+	// only the changes made while disconnected come through
+	for _, expected := range []Event{
+		newEvent(EventTypePut, "b/c", 3.0),
+		newEvent(EventTypePut, "d", 4.0),
+		newEvent(EventTypePut, "e", nil),
+	} {
+		event := readEvent(t, notifications)
+		assert.Equal(t, expected, event)
+
+		var v interface{}
+		require.NoError(t, event.Value(&v))
+		assert.Equal(t, expected.Data, v)
+	}
+
+	fb.StopWatching()
+	select {
+	case _, ok := <-notifications:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		require.FailNow(t, "notifications were not closed")
+	}
+}
+
+func TestWatchReconnectRejected(t *testing.T) {
+	t.Parallel()
+	server := newDroppingServer(`{"a":1}`)
+	defer server.Close()
+
+	fb := NewWithOptions(server.URL, WithReconnectPolicy(&ReconnectPolicy{InitialBackoff: 10 * time.Millisecond}))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	assert.Equal(t, EventTypePut, readEvent(t, notifications).Type)
+	assert.Equal(t, EventTypeDisconnected, readEvent(t, notifications).Type)
+
+	event := readEvent(t, notifications)
+	require.Equal(t, EventTypeError, event.Type)
+	var fErr *Error
+	require.True(t, errors.As(event.Data.(error), &fErr))
+	assert.Equal(t, http.StatusUnauthorized, fErr.StatusCode)
+
+	_, ok := <-notifications
+	assert.False(t, ok)
+}
+
+func TestWatchWithoutReconnectPolicy(t *testing.T) {
+	t.Parallel()
+	server := newDroppingServer(`{"a":1}`, `{"a":2}`)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+
+	assert.Equal(t, EventTypePut, readEvent(t, notifications).Type)
+	assert.Equal(t, EventTypeError, readEvent(t, notifications).Type)
+	_, ok := <-notifications
+	assert.False(t, ok)
+}
+
+func TestReconnectPolicyBackoff(t *testing.T) {
+	t.Parallel()
+	p := &ReconnectPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(10))
+
+	p = &ReconnectPolicy{}
+	assert.Equal(t, defaultReconnectInitialBackoff, p.backoff(1))
+	assert.Equal(t, defaultReconnectMaxBackoff, p.backoff(20))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.backoff(1)
+		assert.True(t, d > defaultReconnectInitialBackoff/2 && d <= defaultReconnectInitialBackoff, "%s", d)
+	}
+
+	fb := New(URL, nil)
+	assert.Equal(t, defaultReconnectPolicy, fb.listenerPolicy())
+	fb.SetReconnectPolicy(p)
+	assert.Equal(t, p, fb.Child("foo").listenerPolicy())
+}
+
+func TestSetReconnectPolicyWhileWatching(t *testing.T) {
+	t.Parallel()
+	server := newDroppingServer(`{"a":1}`, `{"a":2}`)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetReconnectPolicy(&ReconnectPolicy{InitialBackoff: 10 * time.Millisecond})
+	sub, err := fb.OnValue(func(snapshot DataSnapshot) {})
+	require.NoError(t, err)
+	defer sub.Cancel()
+
+	// listeners look the policy up as they reconnect
+	for i := 0; i < 10; i++ {
+		fb.SetReconnectPolicy(&ReconnectPolicy{InitialBackoff: time.Millisecond})
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDiffData(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		name     string
+		old, new interface{}
+		expected []Event
+	}{
+		{
+			name: "unchanged",
+			old:  map[string]interface{}{"a": 1.0, "b": []interface{}{"c"}},
+			new:  map[string]interface{}{"a": 1.0, "b": []interface{}{"c"}},
+		},
+		{
+			name:     "value",
+			old:      "foo",
+			new:      map[string]interface{}{"a": 1.0},
+			expected: []Event{newEvent(EventTypePut, "", map[string]interface{}{"a": 1.0})},
+		},
+		{
+			name:     "removed",
+			old:      map[string]interface{}{"a": 1.0},
+			expected: []Event{newEvent(EventTypePut, "", nil)},
+		},
+		{
+			name: "nested",
+			old:  map[string]interface{}{"a": map[string]interface{}{"b": 1.0, "c": 2.0}, "d": true},
+			new:  map[string]interface{}{"a": map[string]interface{}{"b": 1.0, "c": 3.0}, "e": false},
+			expected: []Event{
+				newEvent(EventTypePut, "a/c", 3.0),
+				newEvent(EventTypePut, "d", nil),
+				newEvent(EventTypePut, "e", false),
+			},
+		},
+		{
+			name:     "priority",
+			old:      map[string]interface{}{"a": map[string]interface{}{"b": 1.0, ".priority": 1.0}},
+			new:      map[string]interface{}{"a": map[string]interface{}{"b": 1.0, ".priority": 2.0}},
+			expected: []Event{newEvent(EventTypePut, "a", map[string]interface{}{"b": 1.0, ".priority": 2.0})},
+		},
+	} {
+		assert.Equal(t, test.expected, diffData("", test.old, test.new), test.name)
+	}
+}
@@ -0,0 +1,162 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+)
+
+var defaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy determines how requests that fail with a transient error
+// are retried. A RetryPolicy should not be modified once it has been
+// given to a Firebase reference.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is made,
+	// including the first attempt. Values less than 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is how long to wait before the first retry, every
+	// following retry doubles the wait. Defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps how long to wait between two attempts.
+	// Defaults to 10s.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction, between 0 and 1, of each backoff that is
+	// randomized so that clients do not retry in lockstep.
+	Jitter float64
+
+	// RetryableStatusCodes are the HTTP status codes that are retried.
+	// Defaults to 429, 500, 502, 503 and 504.
+	RetryableStatusCodes []int
+
+	// Retryable, when set, replaces the default logic used to decide
+	// whether an error is transient.
+	Retryable func(err error) bool
+
+	// RetryNonIdempotent allows requests that cannot be safely repeated,
+	// the POST requests made by Push and the writes holding Increment
+	// placeholders, to be retried even if they may have reached Firebase.
+	// By default they are only retried when the connection could not be
+	// established.
+	RetryNonIdempotent bool
+}
+
+// SetRetryPolicy sets the policy used to retry failed requests made
+// from this reference and every reference created from it. A nil
+// policy disables retries.
+func (fb *Firebase) SetRetryPolicy(p *RetryPolicy) {
+	fb.configMtx.Lock()
+	fb.retryPolicy = p
+	fb.configMtx.Unlock()
+}
+
+func (fb *Firebase) retries() *RetryPolicy {
+	fb.configMtx.RLock()
+	defer fb.configMtx.RUnlock()
+	return fb.retryPolicy
+}
+
+// wait blocks for the backoff of the given attempt and reports whether
+// the request that failed with err should be attempted again.
+func (p *RetryPolicy) wait(ctx context.Context, idempotent bool, attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+
+	if !idempotent && !p.RetryNonIdempotent && !isDialError(err) {
+		return false
+	}
+
+	if !p.retryable(err) {
+		return false
+	}
+
+	return sleepContext(ctx, p.backoff(attempt))
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+
+	var fErr *Error
+	if errors.As(err, &fErr) {
+		codes := p.RetryableStatusCodes
+		if codes == nil {
+			codes = defaultRetryableStatusCodes
+		}
+		for _, code := range codes {
+			if fErr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case errors.As(err, new(ErrCanceled)):
+		return false
+	case errors.As(err, new(ErrTimeout)):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.EPIPE):
+		return true
+	}
+	return isDialError(err)
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	return backoff(attempt, p.InitialBackoff, p.MaxBackoff, defaultInitialBackoff, defaultMaxBackoff, p.Jitter)
+}
+
+// backoff doubles the initial wait for every attempt past the first one,
+// up to max, and randomizes the given fraction of it. The defaults are
+// used in place of the initial and max values that are not positive.
+func backoff(attempt int, initial, max, defaultInitial, defaultMax time.Duration, jitter float64) time.Duration {
+	if initial <= 0 {
+		initial = defaultInitial
+	}
+	if max <= 0 {
+		max = defaultMax
+	}
+
+	d := initial
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	if jitter > 0 {
+		d -= time.Duration(jitter * rand.Float64() * float64(d))
+	}
+	return d
+}
+
+// isDialError reports whether err happened while establishing the
+// connection, meaning the request never reached Firebase.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
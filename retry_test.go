@@ -0,0 +1,147 @@
+package firego
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFlakyServer(failures int64, status int) (*httptest.Server, *int64) {
+	attempts := new(int64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(attempts, 1) <= failures {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":"try again"}`))
+			return
+		}
+		w.Write([]byte(`{"name":"-KeyName"}`))
+	}))
+	return server, attempts
+}
+
+func TestRetryPolicy(t *testing.T) {
+	t.Parallel()
+	server, attempts := newFlakyServer(2, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	// children inherit the policy
+	err := fb.Child("foo").Set(true)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 3, atomic.LoadInt64(attempts))
+}
+
+func TestRetryPolicyMaxAttempts(t *testing.T) {
+	t.Parallel()
+	server, attempts := newFlakyServer(5, http.StatusInternalServerError)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+
+	var v interface{}
+	err := fb.Value(&v)
+	require.Error(t, err)
+	assert.EqualValues(t, 2, atomic.LoadInt64(attempts))
+}
+
+func TestRetryPolicyNotRetryable(t *testing.T) {
+	t.Parallel()
+	server, attempts := newFlakyServer(1, http.StatusBadRequest)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	err := fb.Update(map[string]string{"foo": "bar"})
+	require.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt64(attempts))
+}
+
+func TestRetryPolicyNonIdempotent(t *testing.T) {
+	t.Parallel()
+	server, attempts := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	_, err := fb.Push(true)
+	require.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt64(attempts))
+
+	fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryNonIdempotent: true})
+	atomic.StoreInt64(attempts, 0)
+	ref, err := fb.Push(true)
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/-KeyName", ref.URL())
+	assert.EqualValues(t, 2, atomic.LoadInt64(attempts))
+}
+
+func TestRetryPolicyIncrement(t *testing.T) {
+	t.Parallel()
+	server, attempts := newFlakyServer(1, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})
+
+	// the first write may have been applied already
+	err := fb.Update(map[string]interface{}{"count": Increment(1), "at": ServerTimestamp})
+	require.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt64(attempts))
+
+	// other server values are safe to write again
+	atomic.StoreInt64(attempts, 0)
+	require.NoError(t, fb.Set(map[string]interface{}{"at": ServerTimestamp}))
+	assert.EqualValues(t, 2, atomic.LoadInt64(attempts))
+
+	fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryNonIdempotent: true})
+	atomic.StoreInt64(attempts, 0)
+	require.NoError(t, fb.Child("count").Set(Increment(1)))
+	assert.EqualValues(t, 2, atomic.LoadInt64(attempts))
+}
+
+func TestSetRetryPolicyWhileRequesting(t *testing.T) {
+	t.Parallel()
+	server, _ := newFlakyServer(math.MaxInt64, http.StatusServiceUnavailable)
+	defer server.Close()
+
+	// failed requests look the policy up while it changes
+	fb := New(server.URL, nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			fb.SetRetryPolicy(&RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		assert.Error(t, fb.Set(true))
+	}
+	<-done
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+	p := &RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(4))
+	assert.Equal(t, 5*time.Second, p.backoff(40))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.backoff(2)
+		assert.True(t, d > time.Second && d <= 2*time.Second, "backoff %s", d)
+	}
+}
@@ -0,0 +1,74 @@
+package firego
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// keys of the placeholders holding server values
+const (
+	serverValueKey = ".sv"
+	incrementKey   = "increment"
+)
+
+// ServerValue is a placeholder that Firebase replaces with a value computed
+// on its servers at the time of the write. Server values can be given
+// to Set, Update and Push, either directly or nested in maps and structs.
+//
+// Reference https://firebase.google.com/docs/reference/rest/database#section-server-values
+type ServerValue struct {
+	value interface{}
+}
+
+// ServerTimestamp is replaced by the time, in milliseconds since
+// the Unix epoch, at which Firebase processed the write.
+var ServerTimestamp = ServerValue{value: "timestamp"}
+
+// Increment is replaced by the current numeric value at the location,
+// or 0 if there is none, incremented by n.
+func Increment(n float64) ServerValue {
+	return ServerValue{value: map[string]float64{incrementKey: n}}
+}
+
+// MarshalJSON turns the server value into the placeholder
+// understood by Firebase.
+func (sv ServerValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{serverValueKey: sv.value})
+}
+
+// hasIncrement reports whether the JSON encoded body holds Increment
+// placeholders, which make writing it more than once unsafe.
+func hasIncrement(body []byte) bool {
+	if !bytes.Contains(body, []byte(serverValueKey)) {
+		return false
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return false
+	}
+	return containsIncrement(v)
+}
+
+func containsIncrement(v interface{}) bool {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if sv, ok := val[serverValueKey].(map[string]interface{}); ok {
+			if _, ok := sv[incrementKey]; ok {
+				return true
+			}
+		}
+		for _, child := range val {
+			if containsIncrement(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range val {
+			if containsIncrement(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
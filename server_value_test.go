@@ -0,0 +1,76 @@
+package firego
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestServerValueMarshal(t *testing.T) {
+	t.Parallel()
+	type audit struct {
+		CreatedAt interface{} `json:"createdAt"`
+		Visits    ServerValue `json:"visits"`
+	}
+
+	b, err := json.Marshal(map[string]interface{}{
+		"audit": audit{CreatedAt: ServerTimestamp, Visits: Increment(2)},
+		"now":   ServerTimestamp,
+	})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"audit": {"createdAt": {".sv": "timestamp"}, "visits": {".sv": {"increment": 2}}},
+		"now": {".sv": "timestamp"}
+	}`, string(b))
+}
+
+func TestServerValue(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	before := float64(time.Now().UnixNano() / int64(time.Millisecond))
+
+	err := fb.Set(map[string]interface{}{
+		"createdAt": ServerTimestamp,
+		"counter":   Increment(1),
+	})
+	require.NoError(t, err)
+
+	err = fb.Update(map[string]interface{}{"counter": Increment(41)})
+	require.NoError(t, err)
+
+	ref, err := fb.Push(map[string]interface{}{"counter": Increment(-3)})
+	require.NoError(t, err)
+
+	var v struct {
+		CreatedAt float64 `json:"createdAt"`
+		Counter   float64 `json:"counter"`
+	}
+	require.NoError(t, fb.Value(&v))
+	assert.Equal(t, float64(42), v.Counter)
+	assert.True(t, v.CreatedAt >= before, "timestamp %v is before %v", v.CreatedAt, before)
+
+	require.NoError(t, ref.Value(&v))
+	assert.Equal(t, float64(-3), v.Counter)
+}
+
+func TestHasIncrement(t *testing.T) {
+	t.Parallel()
+	for body, expected := range map[string]bool{
+		``:                          false,
+		`{"a":1}`:                   false,
+		`{"a":{".sv":"timestamp"}}`: false,
+		`{".sv":{"increment":1}}`:   true,
+		`{"a":[1,{"b":{".sv":{"increment":-2}}}]}`: true,
+		`{"a":".sv"}`: false,
+	} {
+		assert.Equal(t, expected, hasIncrement([]byte(body)), body)
+	}
+}
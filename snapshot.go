@@ -13,12 +13,18 @@ type DataSnapshot struct {
 
 	// Value retrieves the data contained in this snapshot.
 	Value interface{}
+
+	// Priority retrieves the priority of the data in this snapshot,
+	// it is only populated when priorities were asked for using
+	// IncludePriority.
+	Priority interface{}
 }
 
 func newSnapshot(node *sync.Node) DataSnapshot {
 	return DataSnapshot{
-		Key:   node.Key,
-		Value: node.Objectify(),
+		Key:      node.Key,
+		Value:    node.Objectify(),
+		Priority: node.Priority,
 	}
 }
 
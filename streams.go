@@ -0,0 +1,394 @@
+package firego
+
+import (
+	"context"
+	"encoding/json"
+	_url "net/url"
+	"strconv"
+	"strings"
+	_sync "sync"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+// streamManager shares the connections watching the locations of a
+// database between the references of a client. References watching
+// the same location with the same query share a single connection, as
+// do the unfiltered references watching a location below another one
+// that is already watched without a query.
+//
+// References created from one another share their manager until they
+// are given interceptors or tokens of their own.
+type streamManager struct {
+	mtx     _sync.Mutex
+	streams map[string]*stream
+}
+
+func newStreamManager() *streamManager {
+	return &streamManager{streams: map[string]*stream{}}
+}
+
+// stream is a connection watching a location, along with a local
+// copy of its data used to catch up the subscribers that join late.
+type stream struct {
+	key      string
+	base     string
+	path     string
+	filtered bool
+	cancel   context.CancelFunc
+
+	// opened is closed once the connection is established,
+	// or err is set.
+	opened chan struct{}
+	err    error
+
+	mtx         _sync.Mutex
+	db          *sync.Database
+	ready       bool
+	subscribers map[*subscriber]bool
+}
+
+// streamKey returns the parts identifying the stream watching the
+// location of the reference: the host and query parameters, the path
+// of the location and whether the query filters its children.
+func (fb *Firebase) streamKey() (base, path string, filtered bool) {
+	if u, err := _url.Parse(fb.url); err == nil {
+		base = u.Scheme + "://" + strings.ToLower(u.Host)
+	}
+
+	fb.paramsMtx.RLock()
+	base += "?" + fb.params.Encode()
+	for _, p := range filterParams {
+		if fb.params.Get(p) != "" {
+			filtered = true
+		}
+	}
+	fb.paramsMtx.RUnlock()
+
+	return base, strings.Trim(fb.Path(), "/"), filtered
+}
+
+// watch streams the events of the location, sharing the connection
+// with the other references of the client watching it.
+func (fb *Firebase) watch(ctx context.Context) (chan Event, error) {
+	if fb.err != nil {
+		return nil, fb.err
+	}
+	fb.configMtx.RLock()
+	streams := fb.streams
+	fb.configMtx.RUnlock()
+	return streams.subscribe(ctx, fb)
+}
+
+func (m *streamManager) subscribe(ctx context.Context, fb *Firebase) (chan Event, error) {
+	base, path, filtered := fb.streamKey()
+
+	m.mtx.Lock()
+	s, rel := m.find(base, path, filtered)
+	if s == nil {
+		s = m.open(fb, base, path, filtered)
+	}
+	sub := &subscriber{
+		ctx:    ctx,
+		path:   rel,
+		events: make(chan Event),
+		wake:   make(chan struct{}, 1),
+	}
+	s.mtx.Lock()
+	s.subscribers[sub] = true
+	if s.ready {
+		// catch up with the data the stream already received
+		var data interface{}
+		if n := s.db.Get(rel); n != nil {
+			data = n.Export()
+		}
+		sub.push(newEvent(EventTypePut, "", data))
+	}
+	s.mtx.Unlock()
+	m.mtx.Unlock()
+
+	select {
+	case <-s.opened:
+	case <-ctx.Done():
+		m.leave(s, sub)
+		return nil, requestError(ctx, ctx.Err())
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	go sub.run(func() { m.leave(s, sub) })
+	return sub.events, nil
+}
+
+// find returns the stream that can serve the location at path, along
+// with the path of the location relative to the one of the stream.
+func (m *streamManager) find(base, path string, filtered bool) (*stream, string) {
+	if s, ok := m.streams[base+" "+path]; ok {
+		return s, ""
+	}
+	if filtered || path == ".info" || strings.HasPrefix(path, ".info/") {
+		return nil, ""
+	}
+
+	var closest *stream
+	for _, s := range m.streams {
+		if s.base != base || s.filtered {
+			continue
+		}
+		if _, ok := within(path, s.path); ok && (closest == nil || len(s.path) > len(closest.path)) {
+			closest = s
+		}
+	}
+	if closest == nil {
+		return nil, ""
+	}
+	rel, _ := within(path, closest.path)
+	return closest, rel
+}
+
+// open starts a stream watching the location of fb, m.mtx must be held.
+func (m *streamManager) open(fb *Firebase, base, path string, filtered bool) *stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &stream{
+		key:         base + " " + path,
+		base:        base,
+		path:        path,
+		filtered:    filtered,
+		cancel:      cancel,
+		opened:      make(chan struct{}),
+		db:          sync.NewDB(),
+		subscribers: map[*subscriber]bool{},
+	}
+	m.streams[s.key] = s
+
+	go func() {
+		events, err := fb.connect(ctx)
+		if err != nil {
+			m.remove(s)
+			s.err = err
+			close(s.opened)
+			cancel()
+			return
+		}
+		close(s.opened)
+		m.dispatch(s, events)
+	}()
+	return s
+}
+
+// dispatch hands the events of the stream to its subscribers.
+func (m *streamManager) dispatch(s *stream, events chan Event) {
+	for event := range events {
+		s.mtx.Lock()
+		switch event.Type {
+		case EventTypePut, EventTypePatch:
+			event.apply(s.db)
+			s.ready = true
+		}
+		for sub := range s.subscribers {
+			sub.push(relocate(event, sub.path)...)
+		}
+		s.mtx.Unlock()
+	}
+
+	// the connection is gone, the subscribers reconnect on their own
+	m.remove(s)
+	s.mtx.Lock()
+	for sub := range s.subscribers {
+		sub.end()
+	}
+	s.mtx.Unlock()
+	s.cancel()
+}
+
+// leave removes the subscriber from the stream,
+// which is torn down along with its last subscriber.
+func (m *streamManager) leave(s *stream, sub *subscriber) {
+	m.mtx.Lock()
+	s.mtx.Lock()
+	delete(s.subscribers, sub)
+	unused := len(s.subscribers) == 0
+	s.mtx.Unlock()
+	if unused && m.streams[s.key] == s {
+		delete(m.streams, s.key)
+	}
+	m.mtx.Unlock()
+
+	if unused {
+		s.cancel()
+	}
+}
+
+// remove makes sure no subscriber joins the stream anymore.
+func (m *streamManager) remove(s *stream) {
+	m.mtx.Lock()
+	if m.streams[s.key] == s {
+		delete(m.streams, s.key)
+	}
+	m.mtx.Unlock()
+}
+
+// subscriber queues the events of a stream until they are read, so
+// that slow subscribers do not hold back the others.
+type subscriber struct {
+	ctx    context.Context
+	path   string
+	events chan Event
+
+	mtx   _sync.Mutex
+	queue []Event
+	ended bool
+	wake  chan struct{}
+}
+
+func (sub *subscriber) push(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+	sub.mtx.Lock()
+	sub.queue = append(sub.queue, events...)
+	sub.mtx.Unlock()
+	sub.signal()
+}
+
+// end lets the subscriber know no more events are coming.
+func (sub *subscriber) end() {
+	sub.mtx.Lock()
+	sub.ended = true
+	sub.mtx.Unlock()
+	sub.signal()
+}
+
+func (sub *subscriber) signal() {
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *subscriber) next() ([]Event, bool) {
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+	events := sub.queue
+	sub.queue = nil
+	return events, sub.ended
+}
+
+// run delivers the queued events until the stream ends or the context
+// of the subscriber is done, in which case an EventTypeError event is
+// sent last. leave is called before the events channel is closed.
+func (sub *subscriber) run(leave func()) {
+	defer close(sub.events)
+
+	canceled := func() {
+		leave()
+		sub.events <- Event{Type: EventTypeError, Data: requestError(sub.ctx, sub.ctx.Err())}
+	}
+	for {
+		events, ended := sub.next()
+		for _, event := range events {
+			select {
+			case sub.events <- event:
+			case <-sub.ctx.Done():
+				canceled()
+				return
+			}
+		}
+		if ended {
+			leave()
+			return
+		}
+
+		select {
+		case <-sub.wake:
+		case <-sub.ctx.Done():
+			canceled()
+			return
+		}
+	}
+}
+
+// relocate turns an event of a stream into the events seen by the
+// subscriber watching the location at path, relative to the stream.
+func relocate(event Event, path string) []Event {
+	if path == "" || (event.Type != EventTypePut && event.Type != EventTypePatch) {
+		return []Event{event}
+	}
+
+	at := strings.Trim(event.Path, "/")
+	if rel, ok := within(at, path); ok {
+		return []Event{newEvent(event.Type, rel, event.Data)}
+	}
+	rest, ok := within(path, at)
+	if !ok {
+		// the change is elsewhere
+		return nil
+	}
+	if event.Type == EventTypePut {
+		return []Event{newEvent(EventTypePut, "", descend(event.Data, rest))}
+	}
+
+	// a patch replaces each of the children it holds
+	var events []Event
+	patch := map[string]interface{}{}
+	children, _ := event.Data.(map[string]interface{})
+	for key, data := range children {
+		childPath := strings.TrimPrefix(at+"/"+key, "/")
+		if rel, ok := within(childPath, path); ok {
+			if rel == "" {
+				events = append(events, newEvent(EventTypePut, "", data))
+				continue
+			}
+			patch[rel] = data
+		} else if rel, ok := within(path, childPath); ok {
+			events = append(events, newEvent(EventTypePut, "", descend(data, rel)))
+		}
+	}
+	if len(patch) > 0 {
+		events = append(events, newEvent(EventTypePatch, "", patch))
+	}
+	return events
+}
+
+// within returns the path of the location at path relative
+// to its ancestor, if ancestor is one.
+func within(path, ancestor string) (string, bool) {
+	switch {
+	case ancestor == "":
+		return path, true
+	case path == ancestor:
+		return "", true
+	case strings.HasPrefix(path, ancestor+"/"):
+		return path[len(ancestor)+1:], true
+	}
+	return "", false
+}
+
+// descend returns the data found at path within data.
+func descend(data interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, "/") {
+		switch val := data.(type) {
+		case map[string]interface{}:
+			data = val[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(val) {
+				return nil
+			}
+			data = val[i]
+		default:
+			return nil
+		}
+	}
+	return data
+}
+
+func newEvent(typ, path string, data interface{}) Event {
+	event := Event{Type: typ, Path: "/" + path, Data: data}
+	event.rawData, _ = json.Marshal(map[string]interface{}{
+		"path": event.Path,
+		"data": data,
+	})
+	return event
+}
@@ -0,0 +1,230 @@
+package firego
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+// countStreams makes fb count the connections it opens to watch locations.
+func countStreams(fb *Firebase) *int64 {
+	count := new(int64)
+	fb.Use(func(req *http.Request, next RoundTripFunc) (*http.Response, error) {
+		if req.Header.Get("Accept") == "text/event-stream" {
+			atomic.AddInt64(count, 1)
+		}
+		return next(req)
+	})
+	return count
+}
+
+func nextSnapshot(t *testing.T, snapshots chan DataSnapshot) DataSnapshot {
+	select {
+	case s := <-snapshots:
+		return s
+	case <-time.After(time.Second):
+		require.FailNow(t, "timed out waiting for a snapshot")
+	}
+	return DataSnapshot{}
+}
+
+func TestSharedStream(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", "Alice")
+
+	root := New(server.URL, nil)
+	count := countStreams(root)
+
+	added := make(chan string, 10)
+	first, err := root.Child("users").ChildAdded(func(snapshot DataSnapshot, previousChildKey string) {
+		added <- snapshot.Key
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", <-added)
+
+	// a late listener catches up with the data already received
+	snapshots := make(chan DataSnapshot, 10)
+	second, err := root.Child("users").OnValue(func(snapshot DataSnapshot) {
+		snapshots <- snapshot
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"alice": "Alice"}, nextSnapshot(t, snapshots).Value)
+
+	server.Set("users/bob", "Bob")
+	assert.Equal(t, "bob", <-added)
+	assert.Equal(t, map[string]interface{}{"alice": "Alice", "bob": "Bob"}, nextSnapshot(t, snapshots).Value)
+	assert.EqualValues(t, 1, atomic.LoadInt64(count))
+
+	// the connection goes away along with its last listener
+	first.Cancel()
+	second.Cancel()
+	<-first.Done()
+	<-second.Done()
+	require.Eventually(t, func() bool {
+		root.streams.mtx.Lock()
+		defer root.streams.mtx.Unlock()
+		return len(root.streams.streams) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	third, err := root.Child("users").OnValue(func(snapshot DataSnapshot) {
+		snapshots <- snapshot
+	})
+	require.NoError(t, err)
+	defer third.Cancel()
+	assert.Equal(t, map[string]interface{}{"alice": "Alice", "bob": "Bob"}, nextSnapshot(t, snapshots).Value)
+	assert.EqualValues(t, 2, atomic.LoadInt64(count))
+}
+
+func TestSharedStreamDescendant(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users", map[string]interface{}{
+		"alice": map[string]interface{}{"name": "Alice"},
+		"bob":   map[string]interface{}{"name": "Bob"},
+	})
+
+	root := New(server.URL, nil)
+	count := countStreams(root)
+
+	users := make(chan DataSnapshot, 10)
+	sub, err := root.Child("users").OnValue(func(snapshot DataSnapshot) {
+		users <- snapshot
+	})
+	require.NoError(t, err)
+	defer sub.Cancel()
+	nextSnapshot(t, users)
+
+	bobs := make(chan DataSnapshot, 10)
+	sub, err = root.Child("users/bob").OnValue(func(snapshot DataSnapshot) {
+		bobs <- snapshot
+	})
+	require.NoError(t, err)
+	defer sub.Cancel()
+	assert.Equal(t, DataSnapshot{Key: "bob", Value: map[string]interface{}{"name": "Bob"}}, nextSnapshot(t, bobs))
+
+	server.Set("users/bob/name", "Robert")
+	nextSnapshot(t, users)
+	assert.Equal(t, map[string]interface{}{"name": "Robert"}, nextSnapshot(t, bobs).Value)
+
+	server.Update("users", map[string]interface{}{"bob": map[string]interface{}{"age": 30.0}})
+	nextSnapshot(t, users)
+	assert.Equal(t, map[string]interface{}{"age": 30.0}, nextSnapshot(t, bobs).Value)
+
+	server.Set("users/alice/name", "Alicia")
+	nextSnapshot(t, users)
+	select {
+	case s := <-bobs:
+		assert.Fail(t, "changes elsewhere reached the listener", "%#v", s)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.Delete("users")
+	nextSnapshot(t, users)
+	assert.Nil(t, nextSnapshot(t, bobs).Value)
+	assert.EqualValues(t, 1, atomic.LoadInt64(count))
+}
+
+func TestSharedStreamQueries(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	root := New(server.URL, nil)
+	count := countStreams(root)
+
+	snapshots := make(chan DataSnapshot, 10)
+	fn := func(snapshot DataSnapshot) {
+		snapshots <- snapshot
+	}
+	sub, err := root.OnValue(fn)
+	require.NoError(t, err)
+	defer sub.Cancel()
+	nextSnapshot(t, snapshots)
+
+	// queries only see some of the children
+	sub, err = root.Child("users").OrderBy("name").LimitToFirst(1).OnValue(fn)
+	require.NoError(t, err)
+	defer sub.Cancel()
+	nextSnapshot(t, snapshots)
+
+	// and different credentials see different data
+	other := root.Child("users")
+	other.Auth("token")
+	sub, err = other.OnValue(fn)
+	require.NoError(t, err)
+	defer sub.Cancel()
+	nextSnapshot(t, snapshots)
+
+	assert.EqualValues(t, 3, atomic.LoadInt64(count))
+}
+
+func TestRelocate(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		name     string
+		event    Event
+		path     string
+		expected []Event
+	}{
+		{
+			name:     "same location",
+			event:    newEvent(EventTypePatch, "a", map[string]interface{}{"b": 1.0}),
+			path:     "",
+			expected: []Event{newEvent(EventTypePatch, "a", map[string]interface{}{"b": 1.0})},
+		},
+		{
+			name:     "descendant",
+			event:    newEvent(EventTypePut, "users/bob/name", "Bob"),
+			path:     "users/bob",
+			expected: []Event{newEvent(EventTypePut, "name", "Bob")},
+		},
+		{
+			name:     "ancestor put",
+			event:    newEvent(EventTypePut, "", map[string]interface{}{"users": map[string]interface{}{"bob": "Bob"}}),
+			path:     "users/bob",
+			expected: []Event{newEvent(EventTypePut, "", "Bob")},
+		},
+		{
+			name:     "missing data",
+			event:    newEvent(EventTypePut, "users", []interface{}{"Alice"}),
+			path:     "users/1",
+			expected: []Event{newEvent(EventTypePut, "", nil)},
+		},
+		{
+			name:     "ancestor patch",
+			event:    newEvent(EventTypePatch, "users", map[string]interface{}{"bob": "Bob", "alice": "Alice"}),
+			path:     "users/bob",
+			expected: []Event{newEvent(EventTypePut, "", "Bob")},
+		},
+		{
+			name:     "patch of deeper paths",
+			event:    newEvent(EventTypePatch, "", map[string]interface{}{"users/bob/name": "Bob"}),
+			path:     "users/bob",
+			expected: []Event{newEvent(EventTypePatch, "", map[string]interface{}{"name": "Bob"})},
+		},
+		{
+			name:  "elsewhere",
+			event: newEvent(EventTypePut, "users/bobby", "Bobby"),
+			path:  "users/bob",
+		},
+		{
+			name:     "errors",
+			event:    Event{Type: EventTypeError, Data: ErrInvalidPath},
+			path:     "users/bob",
+			expected: []Event{{Type: EventTypeError, Data: ErrInvalidPath}},
+		},
+	} {
+		assert.Equal(t, test.expected, relocate(test.event, test.path), test.name)
+	}
+}
@@ -0,0 +1,65 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Subscription is a listener set on a firebase reference. Every call
+// that sets a listener returns a new Subscription, even when it is
+// given a function that is already listening.
+type Subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func newSubscription(cancel context.CancelFunc) *Subscription {
+	return &Subscription{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Cancel removes the listener.
+func (s *Subscription) Cancel() {
+	s.cancel()
+}
+
+// Done returns a channel that is closed once the listener is removed,
+// after which its function is not called anymore.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns nil while the listener is active. Once Done is closed it
+// returns an ErrCanceled or ErrTimeout if the listener was canceled, or
+// the error with which Firebase refused to let it reconnect.
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+func (s *Subscription) finish(err error) {
+	s.err = err
+	close(s.done)
+}
+
+// rejected reports whether err means Firebase will not let a
+// listener reconnect no matter how many times it tries.
+func rejected(err error) bool {
+	var fErr *Error
+	if errors.As(err, &fErr) {
+		switch fErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return false
+		}
+		return fErr.StatusCode/100 == 4
+	}
+	return errors.Is(err, ErrInvalidPath)
+}
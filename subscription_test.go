@@ -0,0 +1,117 @@
+package firego
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestSubscriptionSameFunc(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	added := make(chan string, 10)
+	fn := func(snapshot DataSnapshot, previousChildKey string) {
+		added <- snapshot.Key
+	}
+	first, err := fb.ChildAdded(fn)
+	require.NoError(t, err)
+	second, err := fb.ChildAdded(fn)
+	require.NoError(t, err)
+	assert.Nil(t, first.Err())
+
+	server.Set("hello", true)
+	for i := 0; i < 2; i++ {
+		select {
+		case key := <-added:
+			assert.Equal(t, "hello", key)
+		case <-time.After(time.Second):
+			require.FailNow(t, "child was not added")
+		}
+	}
+
+	first.Cancel()
+	select {
+	case <-first.Done():
+	case <-time.After(time.Second):
+		require.FailNow(t, "subscription was not canceled")
+	}
+	assert.True(t, errors.As(first.Err(), &ErrCanceled{}))
+
+	// the other registration keeps listening
+	server.Set("goodbye", true)
+	select {
+	case key := <-added:
+		assert.Equal(t, "goodbye", key)
+	case <-time.After(time.Second):
+		require.FailNow(t, "child was not added")
+	}
+	select {
+	case key := <-added:
+		assert.Fail(t, "canceled listener was called", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Nil(t, second.Err())
+	second.Cancel()
+}
+
+func TestSubscriptionRejected(t *testing.T) {
+	t.Parallel()
+	var count = new(int64)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt64(count, 1) > 1 {
+			http.Error(w, `{"error":"Permission denied"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: %s\n\n", `{"path":"/", "data":{"hello":"world"}}`)
+	}))
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.SetReconnectPolicy(&ReconnectPolicy{InitialBackoff: 10 * time.Millisecond})
+	sub, err := fb.ChildAdded(func(snapshot DataSnapshot, previousChildKey string) {})
+	require.NoError(t, err)
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		require.FailNow(t, "subscription did not end")
+	}
+	var fErr *Error
+	require.True(t, errors.As(sub.Err(), &fErr))
+	assert.Equal(t, http.StatusUnauthorized, fErr.StatusCode)
+
+	fb.eventMtx.Lock()
+	assert.Len(t, fb.eventFuncs, 0)
+	fb.eventMtx.Unlock()
+}
+
+func TestRejected(t *testing.T) {
+	t.Parallel()
+	for _, test := range []struct {
+		err      error
+		rejected bool
+	}{
+		{&Error{StatusCode: http.StatusUnauthorized}, true},
+		{&Error{StatusCode: http.StatusNotFound}, true},
+		{&Error{StatusCode: http.StatusRequestTimeout}, false},
+		{&Error{StatusCode: http.StatusTooManyRequests}, false},
+		{&Error{StatusCode: http.StatusServiceUnavailable}, false},
+		{&InvalidPathError{Path: "a.b"}, true},
+		{errors.New("connection reset"), false},
+	} {
+		assert.Equal(t, test.rejected, rejected(test.err), "%v", test.err)
+	}
+}
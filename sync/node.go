@@ -9,6 +9,13 @@ import (
 	"sync"
 )
 
+// keys used by the export format to hold the priority of a
+// location and the value of a location that has a priority
+const (
+	priorityKey = ".priority"
+	valueKey    = ".value"
+)
+
 // Node represents an object linked in Database. This object
 // should not be created by hand, use NewNode when creating
 // a new instance of Node.
@@ -17,12 +24,15 @@ type Node struct {
 	Key      string
 	Value    interface{}
 	Children map[string]*Node
+	Priority interface{}
 
 	Parent    *Node
 	sliceKids bool
 }
 
-// NewNode converts the given data into a node.
+// NewNode converts the given data into a node. Data in the export
+// format has its ".priority" and ".value" keys turned into the
+// priority and value of the node.
 func NewNode(key string, data interface{}) *Node {
 	n := &Node{
 		Key: key,
@@ -42,6 +52,15 @@ func NewNode(key string, data interface{}) *Node {
 			v := val.MapIndex(k)
 			key := fmt.Sprintf("%s", k.Interface())
 
+			switch key {
+			case priorityKey:
+				n.Priority = v.Interface()
+				continue
+			case valueKey:
+				n.adopt(NewNode(n.Key, v.Interface()))
+				continue
+			}
+
 			child := NewNode(key, v.Interface())
 			child.Parent = n
 			n.Children[key] = child
@@ -95,13 +114,10 @@ func (n *Node) Objectify() interface{} {
 		return n.Value
 	}
 
-	if n.sliceKids {
-		obj := make([]interface{}, len(n.Children))
+	if length, ok := n.listLength(); ok {
+		obj := make([]interface{}, length)
 		for k, v := range n.Children {
-			index, err := strconv.Atoi(k)
-			if err != nil {
-				continue
-			}
+			index, _ := strconv.Atoi(k)
 			obj[index] = v.Objectify()
 		}
 		return obj
@@ -115,6 +131,46 @@ func (n *Node) Objectify() interface{} {
 	return obj
 }
 
+// Export turns the node and all its children into a go type just
+// like Objectify does, but keeps the priorities by using the
+// export format.
+func (n *Node) Export() interface{} {
+	n.mtx.RLock()
+	defer n.mtx.RUnlock()
+
+	if n.isNil() {
+		return nil
+	}
+
+	if n.Value != nil {
+		if n.Priority == nil {
+			return n.Value
+		}
+		return map[string]interface{}{
+			valueKey:    n.Value,
+			priorityKey: n.Priority,
+		}
+	}
+
+	if length, ok := n.listLength(); ok && n.Priority == nil {
+		obj := make([]interface{}, length)
+		for k, v := range n.Children {
+			index, _ := strconv.Atoi(k)
+			obj[index] = v.Export()
+		}
+		return obj
+	}
+
+	obj := map[string]interface{}{}
+	for k, v := range n.Children {
+		obj[k] = v.Export()
+	}
+	if n.Priority != nil {
+		obj[priorityKey] = n.Priority
+	}
+	return obj
+}
+
 // Child gets a DataSnapshot for the location at the specified relative path.
 // The relative path can either be a simple child key (e.g. 'fred') or a deeper
 // slash-separated path (e.g. 'fred/name/first').
@@ -138,6 +194,28 @@ func (n *Node) Child(name string) (*Node, bool) {
 	return current, true
 }
 
+// listLength returns the length of the list formed by the children of
+// a node created from a slice. Once elements are removed the remaining
+// ones keep their indices, so like Firebase does the children are only
+// considered a list while more than half of the indices are set.
+func (n *Node) listLength() (int, bool) {
+	if !n.sliceKids {
+		return 0, false
+	}
+
+	length := 0
+	for k := range n.Children {
+		index, err := strconv.Atoi(k)
+		if err != nil || index < 0 {
+			return 0, false
+		}
+		if index >= length {
+			length = index + 1
+		}
+	}
+	return length, 2*len(n.Children) > length
+}
+
 func (n *Node) isNil() bool {
 	n.mtx.RLock()
 	defer n.mtx.RUnlock()
@@ -153,6 +231,22 @@ func (n *Node) merge(newNode *Node) {
 		n.Children[k] = v
 	}
 	n.Value = newNode.Value
+	if newNode.Priority != nil {
+		n.Priority = newNode.Priority
+	}
+}
+
+// adopt takes over the value and children of the given node.
+func (n *Node) adopt(other *Node) {
+	n.Value = other.Value
+	n.sliceKids = other.sliceKids
+	for k, v := range other.Children {
+		v.Parent = n
+		n.Children[k] = v
+	}
+	if other.Priority != nil {
+		n.Priority = other.Priority
+	}
 }
 
 func (n *Node) prune() *Node {
@@ -193,6 +193,51 @@ func TestObjectify(t *testing.T) {
 	}
 }
 
+func TestNewNodeExportFormat(t *testing.T) {
+	node := NewNode("", map[string]interface{}{
+		".priority": 1.0,
+		"leaf": map[string]interface{}{
+			".value":    "foo",
+			".priority": "a",
+		},
+		"plain": true,
+	})
+
+	assert.Equal(t, 1.0, node.Priority)
+	assert.Equal(t, map[string]interface{}{"leaf": "foo", "plain": true}, node.Objectify())
+
+	leaf, ok := node.Child("leaf")
+	require.True(t, ok)
+	assert.Equal(t, "foo", leaf.Value)
+	assert.Equal(t, "a", leaf.Priority)
+}
+
+func TestExport(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		object interface{}
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:   "no priorities",
+			object: map[string]interface{}{"foo": "bar", "list": []interface{}{1.0, 2.0}},
+		},
+		{
+			name: "priorities",
+			object: map[string]interface{}{
+				".priority": "root",
+				"leaf":      map[string]interface{}{".value": 2.0, ".priority": 1.0},
+				"object":    map[string]interface{}{".priority": 2.0, "foo": "bar"},
+			},
+		},
+	} {
+		node := NewNode("", test.object)
+		assert.Equal(t, test.object, node.Export(), test.name)
+	}
+}
+
 func TestChild(t *testing.T) {
 	node := NewNode("", map[string]interface{}{
 		"one": map[string]interface{}{
@@ -307,3 +352,18 @@ func TestPrune(t *testing.T) {
 	n.Parent = NewNode("", "hello!")
 	assert.Nil(t, n.prune())
 }
+
+func TestSparseList(t *testing.T) {
+	db := NewDB()
+	db.Add("list", NewNode("list", []interface{}{"a", "b", "c"}))
+
+	db.Del("list/0")
+	node := db.Get("list")
+	assert.Equal(t, []interface{}{nil, "b", "c"}, node.Objectify())
+	assert.Equal(t, []interface{}{nil, "b", "c"}, node.Export())
+
+	// like Firebase, mostly empty lists become objects
+	db.Del("list/1")
+	assert.Equal(t, map[string]interface{}{"2": "c"}, node.Objectify())
+	assert.Equal(t, map[string]interface{}{"2": "c"}, node.Export())
+}
@@ -0,0 +1,149 @@
+/*
+Package token creates the custom tokens used to authenticate to Firebase
+databases that are secured with a legacy database secret.
+
+Reference https://www.firebase.com/docs/rest/guide/user-auth.html#section-rest-tokens-without-helpers
+*/
+package token
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zabawaba99/firego"
+)
+
+// limits enforced by Firebase on custom tokens
+const (
+	maxTokenLength = 1024
+	maxUIDLength   = 256
+)
+
+var (
+	// ErrNoSecret is returned when a token is created without a secret.
+	ErrNoSecret = errors.New("token: missing secret")
+	// ErrMissingUID is returned when a token that is not for an admin
+	// is created without a uid.
+	ErrMissingUID = errors.New(`token: data must contain a "uid"`)
+)
+
+// header is the same for every token
+var header = encodeSegment([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Data is made available to the security rules as the auth variable.
+// It must contain a "uid" string unless the token is for an admin.
+type Data map[string]interface{}
+
+// Options are the optional claims of a token.
+type Options struct {
+	// Expiration is when the token stops being valid. Firebase
+	// expires tokens 24 hours after they were issued by default.
+	Expiration time.Time
+	// NotBefore is when the token starts being valid.
+	NotBefore time.Time
+	// Admin gives the token read and write access to all the data,
+	// regardless of the security rules.
+	Admin bool
+	// Debug enables debug output for the security rules, which is
+	// sent as rules_debug events to the locations being watched.
+	Debug bool
+}
+
+type claims struct {
+	Version   int   `json:"v"`
+	IssuedAt  int64 `json:"iat"`
+	Data      Data  `json:"d,omitempty"`
+	Expires   int64 `json:"exp,omitempty"`
+	NotBefore int64 `json:"nbf,omitempty"`
+	Admin     bool  `json:"admin,omitempty"`
+	Debug     bool  `json:"debug,omitempty"`
+}
+
+// New creates a token holding the given data, signed with the secret.
+// The options can be nil.
+func New(secret string, data Data, opts *Options) (string, error) {
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if uid, ok := data["uid"].(string); ok {
+		if len(uid) > maxUIDLength {
+			return "", fmt.Errorf("token: uid must be at most %d characters long", maxUIDLength)
+		}
+	} else if !opts.Admin {
+		return "", ErrMissingUID
+	}
+
+	c := claims{
+		IssuedAt: time.Now().Unix(),
+		Data:     data,
+		Admin:    opts.Admin,
+		Debug:    opts.Debug,
+	}
+	if !opts.Expiration.IsZero() {
+		c.Expires = opts.Expiration.Unix()
+	}
+	if !opts.NotBefore.IsZero() {
+		c.NotBefore = opts.NotBefore.Unix()
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("token: failed to marshal claims. %s", err)
+	}
+
+	unsigned := header + "." + encodeSegment(payload)
+	hasher := hmac.New(sha256.New, []byte(secret))
+	hasher.Write([]byte(unsigned))
+
+	token := unsigned + "." + encodeSegment(hasher.Sum(nil))
+	if len(token) > maxTokenLength {
+		return "", fmt.Errorf("token: must be at most %d characters long", maxTokenLength)
+	}
+	return token, nil
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Source is a firego.TokenSource handing out a new token, valid for TTL,
+// every time it is asked for one.
+type Source struct {
+	// Secret is used to sign the tokens.
+	Secret string
+	// Data is put in every token.
+	Data Data
+	// Admin and Debug are set on every token, see Options.
+	Admin, Debug bool
+	// TTL is how long tokens are valid for. Defaults to 1 hour.
+	TTL time.Duration
+}
+
+// Token creates a new token.
+func (s *Source) Token(ctx context.Context) (*firego.Token, error) {
+	ttl := s.TTL
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+
+	expiry := time.Now().Add(ttl)
+	token, err := New(s.Secret, s.Data, &Options{
+		Expiration: expiry,
+		Admin:      s.Admin,
+		Debug:      s.Debug,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &firego.Token{Value: token, Expiry: expiry}, nil
+}
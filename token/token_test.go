@@ -0,0 +1,136 @@
+package token
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestNew(t *testing.T) {
+	token, err := New("foo", Data{"uid": "1", "name": "bar"}, &Options{
+		Expiration: time.Unix(2000000000, 0),
+		NotBefore:  time.Unix(1000000000, 0),
+		Debug:      true,
+	})
+	require.NoError(t, err)
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+	assert.Equal(t, "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9", parts[0])
+
+	payload, err := decodeSegment(parts[1])
+	require.NoError(t, err)
+	var claim map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &claim))
+
+	assert.Equal(t, float64(0), claim["v"])
+	assert.InDelta(t, time.Now().Unix(), claim["iat"], 5)
+	assert.Equal(t, map[string]interface{}{"uid": "1", "name": "bar"}, claim["d"])
+	assert.Equal(t, float64(2000000000), claim["exp"])
+	assert.Equal(t, float64(1000000000), claim["nbf"])
+	assert.Equal(t, true, claim["debug"])
+	assert.NotContains(t, claim, "admin")
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New("", Data{"uid": "1"}, nil)
+	assert.Equal(t, ErrNoSecret, err)
+
+	_, err = New("foo", Data{"name": "bar"}, nil)
+	assert.Equal(t, ErrMissingUID, err)
+
+	_, err = New("foo", Data{"uid": strings.Repeat("a", maxUIDLength+1)}, nil)
+	assert.Error(t, err)
+
+	_, err = New("foo", Data{"uid": "1", "big": strings.Repeat("a", maxTokenLength)}, nil)
+	assert.Error(t, err)
+
+	// admins do not need a uid
+	_, err = New("foo", nil, &Options{Admin: true})
+	assert.NoError(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.RequireAuth(true)
+
+	for _, test := range []struct {
+		name   string
+		secret string
+		data   Data
+		opts   *Options
+		status int
+	}{
+		{
+			name:   "valid",
+			secret: server.Secret,
+			data:   Data{"uid": "1"},
+			status: http.StatusOK,
+		},
+		{
+			name:   "admin",
+			secret: server.Secret,
+			opts:   &Options{Admin: true, Debug: true},
+			status: http.StatusOK,
+		},
+		{
+			name:   "wrong secret",
+			secret: "foo",
+			data:   Data{"uid": "1"},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "expired",
+			secret: server.Secret,
+			data:   Data{"uid": "1"},
+			opts:   &Options{Expiration: time.Now().Add(-time.Minute)},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "not valid yet",
+			secret: server.Secret,
+			data:   Data{"uid": "1"},
+			opts:   &Options{NotBefore: time.Now().Add(time.Hour)},
+			status: http.StatusUnauthorized,
+		},
+	} {
+		token, err := New(test.secret, test.data, test.opts)
+		require.NoError(t, err, test.name)
+
+		resp, err := http.Get(server.URL + "/.json?auth=" + token)
+		require.NoError(t, err, test.name)
+		resp.Body.Close()
+		assert.Equal(t, test.status, resp.StatusCode, test.name)
+	}
+}
+
+func TestSource(t *testing.T) {
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.RequireAuth(true)
+
+	src := &Source{Secret: server.Secret, Data: Data{"uid": "1"}, TTL: time.Minute}
+	tok, err := src.Token(context.Background())
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), tok.Expiry.Unix(), 5)
+
+	fb := firego.NewWithOptions(server.URL, firego.WithTokenSource(src))
+	require.NoError(t, fb.Child("foo").Set(true))
+	assert.Equal(t, true, server.Get("foo"))
+}
+
+func decodeSegment(seg string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(seg)
+}
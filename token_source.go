@@ -0,0 +1,149 @@
+package firego
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenExpiryDelta is how long before its expiry a token
+// is considered expired, to account for clock skew.
+const tokenExpiryDelta = 10 * time.Second
+
+// TokenType determines how a token is sent to Firebase.
+type TokenType string
+
+const (
+	// TokenTypeAuth is the type of database secrets as well as custom
+	// and ID tokens, which are sent as the auth query parameter.
+	TokenTypeAuth TokenType = "auth"
+	// TokenTypeAccess is the type of OAuth2 access tokens, which are
+	// sent as the access_token query parameter.
+	TokenTypeAccess TokenType = "access_token"
+	// TokenTypeBearer is the type of OAuth2 access tokens that are sent
+	// in the Authorization header, which keeps them out of the URLs
+	// that could end up in logs.
+	TokenTypeBearer TokenType = "bearer"
+)
+
+// Token is a credential used to authenticate to Firebase.
+type Token struct {
+	// Value is the token itself.
+	Value string
+	// Type determines how the token is sent, defaults to TokenTypeAuth.
+	Type TokenType
+	// Expiry is when the token expires, the zero value means
+	// the token is used until Firebase rejects it.
+	Expiry time.Time
+}
+
+func (t *Token) expired() bool {
+	return !t.Expiry.IsZero() && time.Now().Add(tokenExpiryDelta).After(t.Expiry)
+}
+
+// TokenSource supplies the tokens used to authenticate to Firebase.
+//
+// Token is called for the first request and then again whenever the
+// previous token expired or was rejected by Firebase, either with a 401
+// response or with an auth_revoked event on a connection watching a
+// location, so it should hand out a new token every time it is called.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc is an adapter to allow the use of ordinary functions
+// as a TokenSource.
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+// Token calls f(ctx).
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// StaticTokenSource returns a TokenSource that always hands out the
+// given token, which is useful for database secrets that never expire.
+func StaticTokenSource(t *Token) TokenSource {
+	return TokenSourceFunc(func(context.Context) (*Token, error) {
+		return t, nil
+	})
+}
+
+// tokenCache holds on to the token handed out by a TokenSource
+// until it expires or is rejected. It is shared by all the
+// references created from the one it was set on.
+type tokenCache struct {
+	src TokenSource
+
+	mtx sync.Mutex
+	tok *Token
+}
+
+func newTokenCache(src TokenSource) *tokenCache {
+	if src == nil {
+		return nil
+	}
+	return &tokenCache{src: src}
+}
+
+func (c *tokenCache) token(ctx context.Context) (*Token, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	if c.tok != nil && !c.tok.expired() {
+		return c.tok, nil
+	}
+
+	tok, err := c.src.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if tok == nil {
+		return nil, errors.New("no token returned by the token source")
+	}
+	c.tok = tok
+	return tok, nil
+}
+
+// invalidate forgets the current token so that a new one
+// is requested for the next request.
+func (c *tokenCache) invalidate() {
+	c.mtx.Lock()
+	c.tok = nil
+	c.mtx.Unlock()
+}
+
+// refreshToken reports whether err was caused by Firebase rejecting
+// the current token, in which case a new one is used from now on.
+func (fb *Firebase) refreshToken(err error) bool {
+	var fErr *Error
+	tokens := fb.tokenCache()
+	if tokens == nil || !errors.As(err, &fErr) || fErr.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+
+	tokens.invalidate()
+	return true
+}
+
+func (fb *Firebase) tokenCache() *tokenCache {
+	fb.configMtx.RLock()
+	defer fb.configMtx.RUnlock()
+	return fb.tokens
+}
+
+// AccessToken sets the OAuth2 access token used to authenticate to
+// Firebase, it is sent in the Authorization header of every request.
+func (fb *Firebase) AccessToken(token string) {
+	fb.SetTokenSource(StaticTokenSource(&Token{Value: token, Type: TokenTypeBearer}))
+}
+
+// SetTokenSource sets the source of the tokens used to authenticate
+// to Firebase, they take precedence over the one given to Auth.
+func (fb *Firebase) SetTokenSource(src TokenSource) {
+	fb.configMtx.Lock()
+	fb.tokens = newTokenCache(src)
+	fb.streams = newStreamManager()
+	fb.configMtx.Unlock()
+}
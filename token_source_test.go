@@ -0,0 +1,223 @@
+package firego
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+// rotatingTokens hands out "token-1", "token-2"... every time it is called.
+func rotatingTokens(calls *int64) TokenSource {
+	return TokenSourceFunc(func(context.Context) (*Token, error) {
+		n := atomic.AddInt64(calls, 1)
+		return &Token{Value: fmt.Sprintf("token-%d", n)}, nil
+	})
+}
+
+func TestTokenSourceRefresh(t *testing.T) {
+	t.Parallel()
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token := req.URL.Query().Get(authParam)
+		received = append(received, token)
+		if token != "token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error": "Auth token is expired"}`)
+			return
+		}
+		fmt.Fprint(w, "true")
+	}))
+	defer server.Close()
+
+	calls := new(int64)
+	fb := NewWithOptions(server.URL, WithTokenSource(rotatingTokens(calls)))
+	require.NoError(t, fb.Set(true))
+	require.NoError(t, fb.Child("foo").Set(true))
+	assert.Equal(t, []string{"token-1", "token-2", "token-2"}, received)
+	assert.EqualValues(t, 2, atomic.LoadInt64(calls))
+
+	// a rejected refreshed token is not refreshed again
+	received = nil
+	fb = NewWithOptions(server.URL, WithTokenSource(StaticTokenSource(&Token{Value: "bad"})))
+	err := fb.Set(true)
+	assert.True(t, IsPermissionDenied(err))
+	assert.Equal(t, []string{"bad", "bad"}, received)
+}
+
+func TestTokenSourceExpiry(t *testing.T) {
+	t.Parallel()
+	calls := new(int64)
+	c := newTokenCache(TokenSourceFunc(func(context.Context) (*Token, error) {
+		atomic.AddInt64(calls, 1)
+		return &Token{Value: "foo", Expiry: time.Now().Add(tokenExpiryDelta / 2)}, nil
+	}))
+
+	for i := 0; i < 3; i++ {
+		tok, err := c.token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "foo", tok.Value)
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt64(calls))
+
+	c = newTokenCache(StaticTokenSource(&Token{Value: "foo", Expiry: time.Now().Add(time.Hour)}))
+	first, err := c.token(context.Background())
+	require.NoError(t, err)
+	second, err := c.token(context.Background())
+	require.NoError(t, err)
+	assert.True(t, first == second, "token was not reused")
+}
+
+func TestTokenTypeAccess(t *testing.T) {
+	t.Parallel()
+	server := newTestServer("")
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	fb.Auth("static")
+	fb.SetTokenSource(StaticTokenSource(&Token{Value: "ya29.foo", Type: TokenTypeAccess}))
+	fb.Value("")
+
+	require.Len(t, server.receivedReqs, 1)
+	assert.Equal(t, accessTokenParam+"=ya29.foo", server.receivedReqs[0].URL.Query().Encode())
+}
+
+// newRevokingServer streams the given data, one set per connection, and
+// revokes the token used by every connection but the last one.
+func newRevokingServer(data ...string) (*httptest.Server, *[]string) {
+	var (
+		connections = new(int64)
+		tokens      []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		tokens = append(tokens, req.URL.Query().Get(authParam))
+		n := int(atomic.AddInt64(connections, 1))
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: put\ndata: {\"path\":\"/\",\"data\":%s}\n\n", data[n-1])
+		w.(http.Flusher).Flush()
+		if n < len(data) {
+			fmt.Fprintf(w, "event: %s\ndata: %q\n\n", EventTypeAuthRevoked, "token expired")
+			return
+		}
+		<-req.Context().Done()
+	}))
+	return server, &tokens
+}
+
+func TestWatchAuthRevokedRefresh(t *testing.T) {
+	t.Parallel()
+	server, tokens := newRevokingServer("1", "2")
+	defer server.Close()
+
+	fb := NewWithOptions(server.URL, WithTokenSource(rotatingTokens(new(int64))))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	defer fb.StopWatching()
+
+	for _, expected := range []float64{1, 2} {
+		select {
+		case event := <-notifications:
+			assert.Equal(t, EventTypePut, event.Type)
+			assert.Equal(t, expected, event.Data)
+		case <-time.After(time.Second):
+			require.FailNow(t, "did not receive event")
+		}
+	}
+	assert.Equal(t, []string{"token-1", "token-2"}, *tokens)
+}
+
+func TestChildAddedAuthRevokedRefresh(t *testing.T) {
+	t.Parallel()
+	server, _ := newRevokingServer(`{"a":1}`, `{"a":1,"b":2}`)
+	defer server.Close()
+
+	fb := NewWithOptions(server.URL, WithTokenSource(rotatingTokens(new(int64))))
+	added := make(chan string, 3)
+	fn := func(snapshot DataSnapshot, previousChildKey string) {
+		added <- snapshot.Key
+	}
+	sub, err := fb.ChildAdded(fn)
+	require.NoError(t, err)
+	defer sub.Cancel()
+
+	for _, expected := range []string{"a", "b"} {
+		select {
+		case key := <-added:
+			assert.Equal(t, expected, key)
+		case <-time.After(time.Second):
+			require.FailNow(t, "child was not added")
+		}
+	}
+	select {
+	case key := <-added:
+		assert.Fail(t, "unexpected child added", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAccessToken(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.RequireAuth(true, "ya29.foo")
+
+	// tokens must survive redirects
+	redirectServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, server.URL+req.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}))
+	defer redirectServer.Close()
+
+	fb := New(redirectServer.URL, nil)
+	fb.AccessToken("ya29.foo")
+	require.NoError(t, fb.Child("foo").Set("bar"))
+
+	var v string
+	require.NoError(t, fb.Child("foo").Value(&v))
+	assert.Equal(t, "bar", v)
+
+	foo := fb.Child("foo")
+	notifications := make(chan Event)
+	require.NoError(t, foo.Watch(notifications))
+	event := <-notifications
+	assert.Equal(t, "bar", event.Data)
+	foo.StopWatching()
+
+	fb.Unauth()
+	assert.True(t, IsPermissionDenied(fb.Child("foo").Value(&v)))
+}
+
+func TestUnauthWhileWatching(t *testing.T) {
+	t.Parallel()
+	server, _ := newRevokingServer("1", "2", "3")
+	defer server.Close()
+
+	fb := NewWithOptions(server.URL, WithTokenSource(rotatingTokens(new(int64))))
+	notifications := make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	go func() {
+		// swapping credentials must not get in the way of the connection
+		fb.Unauth()
+		fb.SetTokenSource(rotatingTokens(new(int64)))
+		fb.Use(withHeader("X-Test", "1"))
+		fb.Unauth()
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case event := <-notifications:
+			assert.Equal(t, EventTypePut, event.Type)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out reading notification")
+		}
+	}
+	fb.StopWatching()
+}
@@ -1,82 +1,184 @@
 package firego
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 )
 
+// ErrAbortTransaction can be returned by a TransactionFn to stop the
+// transaction without writing anything and without it being reported
+// as a failure.
+var ErrAbortTransaction = errors.New("transaction aborted")
+
+// defaultTransactionAttempts is the number of times a transaction
+// function is run before giving up when no limit is configured.
+const defaultTransactionAttempts = 25
+
 // TransactionFn is used to run a transaction on a Firebase reference.
 // See Firebase.Transaction for more information.
 type TransactionFn func(currentSnapshot interface{}) (result interface{}, err error)
 
-func getTransactionParams(headers http.Header, body []byte) (etag string, snapshot interface{}, err error) {
-	etag = headers.Get("ETag")
+// TransactionOptions configures how a transaction deals with
+// conflicting writes made by other clients.
+type TransactionOptions struct {
+	// MaxAttempts is the number of times the transaction function
+	// is run before giving up. Defaults to 25.
+	MaxAttempts int
+	// Backoff is the time to wait before retrying after the first conflict,
+	// it is doubled after every subsequent one. The transaction is retried
+	// right away when it is zero.
+	Backoff time.Duration
+	// MaxBackoff caps the time waited between attempts, zero means no cap.
+	MaxBackoff time.Duration
+}
+
+func (o TransactionOptions) backoff(attempt int) time.Duration {
+	d := o.Backoff
+	for i := 1; i < attempt && (o.MaxBackoff == 0 || d < o.MaxBackoff); i++ {
+		d *= 2
+	}
+	if o.MaxBackoff > 0 && d > o.MaxBackoff {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+func getTransactionParams(headers http.Header, body []byte) (etag string, snapshot []byte, err error) {
+	etag = headers.Get(etagHeader)
 	if len(etag) == 0 {
 		return etag, snapshot, errors.New("no etag returned by Firebase")
 	}
+	return etag, body, nil
+}
 
-	if err := json.Unmarshal(body, &snapshot); err != nil {
-		return etag, snapshot, fmt.Errorf("failed to unmarshal Firebase response. %s", err)
+// conflictParams extracts the current etag and value of the location
+// from the error returned by a rejected conditional write.
+func conflictParams(err error, headers http.Header, body []byte) (etag string, snapshot []byte, ok bool) {
+	var pfErr *PreconditionFailedError
+	if errors.As(err, &pfErr) {
+		return pfErr.ETag, pfErr.value, true
 	}
 
-	return etag, snapshot, nil
+	// older servers reject the write with a conflict
+	etag, snapshot, err = getTransactionParams(headers, body)
+	return etag, snapshot, err == nil
 }
 
 // Transaction runs a transaction on the data at this location. The TransactionFn parameter
 // will be called, possibly multiple times, with the current data at this location.
 // It is responsible for inspecting that data and specifying either the desired new data
-// at the location or that the transaction should be aborted.
+// at the location or that the transaction should be aborted by returning ErrAbortTransaction.
+// Any other error returned by the function stops the transaction and is returned.
 //
 // Since the provided function may be called repeatedly for the same transaction, be extremely careful of
 // any side effects that may be triggered by this method.
 //
 // Best practices for this method are to rely only on the data that is passed in.
 func (fb *Firebase) Transaction(fn TransactionFn) error {
+	return fb.TransactionContext(context.Background(), fn)
+}
+
+// TransactionContext is like Transaction but every request made
+// while running the transaction is bound to the given context.
+func (fb *Firebase) TransactionContext(ctx context.Context, fn TransactionFn) error {
+	_, _, err := fb.TransactionWithOptionsContext(ctx, fn, TransactionOptions{})
+	return err
+}
+
+// TransactionWithOptions is like Transaction but retries conflicts as
+// configured by opts. It reports whether the result of the transaction
+// function was committed along with a snapshot of the data at this location
+// once the transaction is over. That is the committed value, or the last
+// value seen by the transaction function if nothing was committed.
+func (fb *Firebase) TransactionWithOptions(fn TransactionFn, opts TransactionOptions) (committed bool, snapshot DataSnapshot, err error) {
+	return fb.TransactionWithOptionsContext(context.Background(), fn, opts)
+}
+
+// TransactionWithOptionsContext is like TransactionWithOptions but every request
+// made while running the transaction is bound to the given context.
+func (fb *Firebase) TransactionWithOptionsContext(ctx context.Context, fn TransactionFn, opts TransactionOptions) (bool, DataSnapshot, error) {
+	snapshot := DataSnapshot{Key: fb.Key()}
+	committed, value, err := fb.transaction(ctx, opts, func(current []byte) ([]byte, error) {
+		var v interface{}
+		if err := json.Unmarshal(current, &v); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal Firebase response. %s", err)
+		}
+
+		result, err := fn(v)
+		if err != nil {
+			return nil, err
+		}
+
+		newBody, err := json.Marshal(result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal transaction result. %s", err)
+		}
+		return newBody, nil
+	})
+	if len(value) > 0 {
+		if uErr := json.Unmarshal(value, &snapshot.Value); uErr != nil && err == nil {
+			err = fmt.Errorf("failed to unmarshal Firebase response. %s", uErr)
+		}
+	}
+	return committed, snapshot, err
+}
+
+// transaction runs fn against the raw JSON data at this location until
+// its result is written without conflicts. It returns whether a result
+// was committed and the last value of the location it knows of.
+func (fb *Firebase) transaction(ctx context.Context, opts TransactionOptions, fn func(current []byte) ([]byte, error)) (bool, []byte, error) {
 	// fetch etag and current value
-	headers, body, err := fb.doRequest("GET", nil, withHeader("X-Firebase-ETag", "true"))
+	headers, body, err := fb.doRequest(ctx, "GET", nil, withHeader(requestETagHeader, "true"))
 	if err != nil {
-		return err
+		return false, nil, err
 	}
 
 	etag, snapshot, err := getTransactionParams(headers, body)
 	if err != nil {
-		return err
+		return false, nil, err
 	}
 
-	// set the error value to something non-nil so that
-	// we step into the loop
-	tErr := errors.New("")
-	for i := 0; i < 25 && tErr != nil; i++ {
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultTransactionAttempts
+	}
+
+	var tErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 && !sleepContext(ctx, opts.backoff(attempt-1)) {
+			return false, snapshot, requestError(ctx, ctx.Err())
+		}
+
 		// run transaction
 		result, err := fn(snapshot)
-		if err != nil {
-			return nil
+		if errors.Is(err, ErrAbortTransaction) {
+			return false, snapshot, nil
 		}
-
-		newBody, err := json.Marshal(result)
 		if err != nil {
-			return fmt.Errorf("failed to marshal transaction result. %s", err)
+			return false, snapshot, err
 		}
 
 		// attempt to update it
-		headers, body, tErr = fb.doRequest("PUT", newBody, withHeader("if-match", etag))
+		headers, body, tErr = fb.doRequest(ctx, "PUT", result, withHeader(ifMatchHeader, etag))
 		if tErr == nil {
-			// we're good, break the loop
-			break
+			if len(body) == 0 {
+				body = result
+			}
+			return true, body, nil
 		}
 
 		// we failed to update, so grab the new snapshot/etag
-		e, s, tErr := getTransactionParams(headers, body)
-		if tErr != nil {
-			return tErr
+		e, s, ok := conflictParams(tErr, headers, body)
+		if !ok {
+			// not a conflict, give back the original failure
+			return false, snapshot, tErr
 		}
 		etag, snapshot = e, s
 	}
 
-	if tErr != nil {
-		return fmt.Errorf("failed to run transaction. %s", tErr)
-	}
-	return nil
+	return false, snapshot, fmt.Errorf("failed to run transaction. %w", tErr)
 }
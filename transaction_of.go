@@ -0,0 +1,65 @@
+//go:build go1.18
+// +build go1.18
+
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// TransactionOf runs a transaction on the data at the location of fb,
+// just like Firebase.TransactionWithOptions, but decodes the current
+// data into a T instead of generic maps. The function is handed a
+// pointer to it, which it modifies in place to specify the new data
+// of the location, and it can return ErrAbortTransaction to stop the
+// transaction without writing anything.
+//
+// Numbers decoded into interface{} values are json.Number so that
+// they are written back without losing precision.
+func TransactionOf[T any](fb *Firebase, fn func(current *T) error, opts TransactionOptions) (committed bool, value T, err error) {
+	return TransactionOfContext(context.Background(), fb, fn, opts)
+}
+
+// TransactionOfContext is like TransactionOf but every request made
+// while running the transaction is bound to the given context.
+func TransactionOfContext[T any](ctx context.Context, fb *Firebase, fn func(current *T) error, opts TransactionOptions) (bool, T, error) {
+	committed, data, err := fb.transaction(ctx, opts, func(current []byte) ([]byte, error) {
+		v, err := decodeTransactionValue[T](current)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := fn(&v); err != nil {
+			return nil, err
+		}
+
+		newBody, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal transaction result. %s", err)
+		}
+		return newBody, nil
+	})
+
+	v, dErr := decodeTransactionValue[T](data)
+	if dErr != nil && err == nil {
+		err = dErr
+	}
+	return committed, v, err
+}
+
+func decodeTransactionValue[T any](data []byte) (T, error) {
+	var v T
+	if len(data) == 0 {
+		return v, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return v, fmt.Errorf("failed to unmarshal Firebase response. %s", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,83 @@
+//go:build go1.18
+// +build go1.18
+
+package firego
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+func TestTransactionOf(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("accounts/alice", map[string]interface{}{"balance": 10, "owner": "Alice"})
+
+	type account struct {
+		Balance int    `json:"balance"`
+		Owner   string `json:"owner"`
+	}
+
+	fb := New(server.URL+"/accounts/alice", nil)
+	var calls int
+	committed, acc, err := TransactionOf(fb, func(acc *account) error {
+		calls++
+		if calls == 1 {
+			// someone else writes in the meantime
+			server.Set("accounts/alice/balance", 20)
+		}
+		if acc.Balance < 5 {
+			return ErrAbortTransaction
+		}
+		acc.Balance -= 5
+		return nil
+	}, TransactionOptions{})
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, account{Balance: 15, Owner: "Alice"}, acc)
+	assert.Equal(t, map[string]interface{}{"balance": float64(15), "owner": "Alice"}, server.Get("accounts/alice"))
+}
+
+func TestTransactionOfMissingValue(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL+"/counter", nil)
+	committed, v, err := TransactionOf(fb, func(count *int) error {
+		*count++
+		return nil
+	}, TransactionOptions{})
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 1, v)
+}
+
+func TestTransactionOfNumberPrecision(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("big", map[string]interface{}{"id": json.Number("9007199254740993")})
+
+	var id interface{}
+	var written []byte
+	fb := New(server.URL+"/big", nil)
+	_, _, err := TransactionOf(fb, func(current *map[string]interface{}) error {
+		id = (*current)["id"]
+		(*current)["seen"] = true
+		written, _ = json.Marshal(*current)
+		return nil
+	}, TransactionOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, json.Number("9007199254740993"), id)
+	assert.Contains(t, string(written), `"id":9007199254740993`)
+}
@@ -2,14 +2,17 @@ package firego
 
 import (
 	"encoding/base64"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
 )
 
 type aBool struct {
@@ -83,3 +86,101 @@ func TestTransaction(t *testing.T) {
 	assert.True(t, storedVal.val())
 	assert.True(t, hitConflict.val())
 }
+
+func TestTransactionWithOptions(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("counter", 1)
+
+	fb := New(server.URL, nil).Child("counter")
+	var calls int
+	committed, snapshot, err := fb.TransactionWithOptions(func(current interface{}) (interface{}, error) {
+		calls++
+		if calls == 1 {
+			// someone else writes in the meantime
+			server.Set("counter", 10)
+		}
+		return current.(float64) + 1, nil
+	}, TransactionOptions{Backoff: time.Millisecond})
+	require.NoError(t, err)
+	assert.True(t, committed)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, DataSnapshot{Key: "counter", Value: float64(11)}, snapshot)
+	assert.EqualValues(t, 11, server.Get("counter"))
+}
+
+func TestTransactionAbort(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("counter", 1)
+
+	fb := New(server.URL+"/counter", nil)
+	committed, snapshot, err := fb.TransactionWithOptions(func(current interface{}) (interface{}, error) {
+		return nil, ErrAbortTransaction
+	}, TransactionOptions{})
+	require.NoError(t, err)
+	assert.False(t, committed)
+	assert.Equal(t, float64(1), snapshot.Value)
+
+	assert.NoError(t, fb.Transaction(func(current interface{}) (interface{}, error) {
+		return nil, ErrAbortTransaction
+	}))
+	assert.EqualValues(t, 1, server.Get("counter"))
+}
+
+func TestTransactionError(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("counter", 1)
+
+	fnErr := errors.New("something went wrong")
+	fb := New(server.URL+"/counter", nil)
+	committed, _, err := fb.TransactionWithOptions(func(current interface{}) (interface{}, error) {
+		return nil, fnErr
+	}, TransactionOptions{})
+	assert.Equal(t, fnErr, err)
+	assert.False(t, committed)
+
+	err = fb.Transaction(func(current interface{}) (interface{}, error) {
+		return nil, fnErr
+	})
+	assert.Equal(t, fnErr, err)
+}
+
+func TestTransactionMaxAttempts(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("counter", 1)
+
+	fb := New(server.URL+"/counter", nil)
+	var calls int
+	committed, snapshot, err := fb.TransactionWithOptions(func(current interface{}) (interface{}, error) {
+		calls++
+		server.Set("counter", calls*100)
+		return current, nil
+	}, TransactionOptions{MaxAttempts: 3})
+	require.Error(t, err)
+	assert.True(t, IsPreconditionFailed(err))
+	assert.False(t, committed)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, float64(300), snapshot.Value)
+}
+
+func TestTransactionOptionsBackoff(t *testing.T) {
+	opts := TransactionOptions{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	assert.Equal(t, 10*time.Millisecond, opts.backoff(1))
+	assert.Equal(t, 20*time.Millisecond, opts.backoff(2))
+	assert.Equal(t, 40*time.Millisecond, opts.backoff(3))
+	assert.Equal(t, 50*time.Millisecond, opts.backoff(4))
+	assert.Equal(t, 50*time.Millisecond, opts.backoff(100))
+
+	assert.Equal(t, time.Duration(0), TransactionOptions{}.backoff(3))
+}
@@ -0,0 +1,273 @@
+//go:build go1.18
+// +build go1.18
+
+package firego
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/zabawaba99/firego/sync"
+)
+
+// TypedRef is a reference whose data is decoded into and encoded from
+// T values, following their json struct tags, instead of generic maps.
+//
+// Get, Set, Update and Watch deal with the data of the location itself
+// while Child, Push and the child listeners treat its children as T
+// values, which suits locations holding lists of items.
+type TypedRef[T any] struct {
+	fb *Firebase
+}
+
+// NewTypedRef creates a TypedRef for the location of fb,
+// sharing its configuration.
+func NewTypedRef[T any](fb *Firebase) *TypedRef[T] {
+	return &TypedRef[T]{fb: fb}
+}
+
+// TypedEvent is a notification received when watching a TypedRef.
+type TypedEvent[T any] struct {
+	// Type of event that was received
+	Type string
+	// Path to the data that changed
+	Path string
+	// Value is the data of the watched location once the change
+	// was applied.
+	Value T
+	// Err is set for EventTypeError and EventTypeDisconnected
+	// events and when the data could not be decoded into a T.
+	Err error
+}
+
+// TypedSnapshot contains the data of a child of a TypedRef.
+type TypedSnapshot[T any] struct {
+	// Key of the child
+	Key string
+	// Value of the child
+	Value T
+	// Priority of the child, only populated when priorities
+	// were asked for using IncludePriority.
+	Priority interface{}
+	// Err is set when the data could not be decoded into a T,
+	// in which case Value is the zero value.
+	Err error
+}
+
+// TypedChildEventFunc is the type of function that is called for
+// the children of a TypedRef.
+type TypedChildEventFunc[T any] func(snapshot TypedSnapshot[T], previousChildKey string)
+
+// Ref returns the untyped reference.
+func (r *TypedRef[T]) Ref() *Firebase {
+	return r.fb
+}
+
+// Child creates a TypedRef for the requested child.
+func (r *TypedRef[T]) Child(child string) *TypedRef[T] {
+	return NewTypedRef[T](r.fb.Child(child))
+}
+
+// Get gets the value of the location, the zero value
+// is returned when there is no data.
+func (r *TypedRef[T]) Get() (T, error) {
+	return r.GetContext(context.Background())
+}
+
+// GetContext is like Get but the request is bound to the given context.
+func (r *TypedRef[T]) GetContext(ctx context.Context) (T, error) {
+	_, body, err := r.fb.doRequest(ctx, "GET", nil)
+	if err != nil {
+		var v T
+		return v, err
+	}
+	return decodeTyped[T](r.fb.Path(), body)
+}
+
+// Set sets the value of the location.
+func (r *TypedRef[T]) Set(v T) error {
+	return r.SetContext(context.Background(), v)
+}
+
+// SetContext is like Set but the request is bound to the given context.
+func (r *TypedRef[T]) SetContext(ctx context.Context, v T) error {
+	return r.fb.SetContext(ctx, v)
+}
+
+// Update writes the children enumerated by partial, which can be a
+// map or a struct whose fields are tagged with omitempty, leaving
+// the others untouched.
+func (r *TypedRef[T]) Update(partial interface{}) error {
+	return r.UpdateContext(context.Background(), partial)
+}
+
+// UpdateContext is like Update but the request is bound to the given context.
+func (r *TypedRef[T]) UpdateContext(ctx context.Context, partial interface{}) error {
+	return r.fb.UpdateContext(ctx, partial)
+}
+
+// Push adds v as a new child of the location
+// and returns the key it was given.
+func (r *TypedRef[T]) Push(v T) (string, error) {
+	return r.PushContext(context.Background(), v)
+}
+
+// PushContext is like Push but the request is bound to the given context.
+func (r *TypedRef[T]) PushContext(ctx context.Context, v T) (string, error) {
+	ref, err := r.fb.PushContext(ctx, v)
+	if err != nil {
+		return "", err
+	}
+	return ref.Key(), nil
+}
+
+// Watch listens for changes of the location and sends its value, once
+// each change is applied, over the returned channel. The channel is
+// closed once StopWatching is called, after an EventTypeError event
+// is sent if the connection could not be established.
+func (r *TypedRef[T]) Watch() <-chan TypedEvent[T] {
+	return r.WatchContext(context.Background())
+}
+
+// WatchContext is like Watch but the connection is
+// bound to the given context.
+func (r *TypedRef[T]) WatchContext(ctx context.Context) <-chan TypedEvent[T] {
+	notifications := make(chan Event)
+	if err := r.fb.WatchContext(ctx, notifications); err != nil {
+		events := make(chan TypedEvent[T], 1)
+		events <- TypedEvent[T]{Type: EventTypeError, Err: err}
+		close(events)
+		return events
+	}
+
+	events := make(chan TypedEvent[T])
+	go func() {
+		defer close(events)
+
+		db := sync.NewDB()
+		for event := range notifications {
+			e := TypedEvent[T]{Type: event.Type, Path: event.Path}
+			switch event.Type {
+			case EventTypePut, EventTypePatch:
+				event.apply(db)
+				e.Value, e.Err = decodeTypedNode[T](r.fb.Path(), db.Get(""))
+			case EventTypeError, EventTypeDisconnected:
+				e.Err, _ = event.Data.(error)
+			}
+			events <- e
+		}
+	}()
+	return events
+}
+
+// StopWatching tears down the connection watching the location.
+func (r *TypedRef[T]) StopWatching() {
+	r.fb.StopWatching()
+}
+
+// ChildAdded executes the callback for every child that is added.
+// The returned Subscription removes the listener.
+func (r *TypedRef[T]) ChildAdded(fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.ChildAddedContext(context.Background(), fn)
+}
+
+// ChildAddedContext is like ChildAdded but the listener is removed
+// once the given context is done.
+func (r *TypedRef[T]) ChildAddedContext(ctx context.Context, fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.fb.addEventFunc(ctx, "", r.fb.childEvents(childAddedEvent, r.untyped(fn)))
+}
+
+// ChildChanged executes the callback for every child that is changed.
+// The returned Subscription removes the listener.
+func (r *TypedRef[T]) ChildChanged(fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.ChildChangedContext(context.Background(), fn)
+}
+
+// ChildChangedContext is like ChildChanged but the listener is removed
+// once the given context is done.
+func (r *TypedRef[T]) ChildChangedContext(ctx context.Context, fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.fb.addEventFunc(ctx, "", r.fb.childEvents(childChangedEvent, r.untyped(fn)))
+}
+
+// ChildRemoved executes the callback for every child that is removed.
+// The returned Subscription removes the listener.
+func (r *TypedRef[T]) ChildRemoved(fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.ChildRemovedContext(context.Background(), fn)
+}
+
+// ChildRemovedContext is like ChildRemoved but the listener is removed
+// once the given context is done.
+func (r *TypedRef[T]) ChildRemovedContext(ctx context.Context, fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.fb.addEventFunc(ctx, "", r.fb.childEvents(childRemovedEvent, r.untyped(fn)))
+}
+
+// ChildMoved executes the callback for every child that moves in the
+// order of the reference's query. The returned Subscription removes
+// the listener.
+func (r *TypedRef[T]) ChildMoved(fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.ChildMovedContext(context.Background(), fn)
+}
+
+// ChildMovedContext is like ChildMoved but the listener is removed
+// once the given context is done.
+func (r *TypedRef[T]) ChildMovedContext(ctx context.Context, fn TypedChildEventFunc[T]) (*Subscription, error) {
+	return r.fb.addEventFunc(ctx, "", r.fb.childEvents(childMovedEvent, r.untyped(fn)))
+}
+
+// untyped wraps fn into a ChildEventFunc that decodes the snapshots.
+func (r *TypedRef[T]) untyped(fn TypedChildEventFunc[T]) ChildEventFunc {
+	return func(snapshot DataSnapshot, previousChildKey string) {
+		s := TypedSnapshot[T]{Key: snapshot.Key, Priority: snapshot.Priority}
+		s.Value, s.Err = decodeTypedNode[T](strings.TrimSuffix(r.fb.Path(), "/")+"/"+snapshot.Key, sync.NewNode(snapshot.Key, snapshot.Value))
+		fn(s, previousChildKey)
+	}
+}
+
+func decodeTypedNode[T any](path string, n *sync.Node) (T, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		var v T
+		return v, err
+	}
+	return decodeTyped[T](path, data)
+}
+
+// decodeTyped decodes the JSON encoded data found at path into a T,
+// rejecting anything but objects when T is a struct.
+func decodeTyped[T any](path string, data []byte) (T, error) {
+	var v T
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return v, nil
+	}
+
+	t := reflect.TypeOf(&v).Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct && data[0] != '{' {
+		return v, fmt.Errorf("the data at %s is a %s, not an object, and cannot be decoded into a %s", path, jsonKind(data), t)
+	}
+
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, fmt.Errorf("failed to decode the data at %s. %s", path, err)
+	}
+	return v, nil
+}
+
+// jsonKind names the kind of the JSON encoded value.
+func jsonKind(data []byte) string {
+	switch data[0] {
+	case '"':
+		return "string"
+	case '[':
+		return "list"
+	case 't', 'f':
+		return "boolean"
+	}
+	return "number"
+}
@@ -0,0 +1,185 @@
+//go:build go1.18
+// +build go1.18
+
+package firego
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zabawaba99/firego/firetest"
+)
+
+type typedUser struct {
+	Name  string `json:"name"`
+	Age   int    `json:"age,omitempty"`
+	Admin bool   `json:"-"`
+}
+
+func TestTypedRef(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	users := NewTypedRef[typedUser](New(server.URL+"/users", nil))
+
+	// missing data is the zero value
+	bob, err := users.Child("bob").Get()
+	require.NoError(t, err)
+	assert.Equal(t, typedUser{}, bob)
+
+	require.NoError(t, users.Child("bob").Set(typedUser{Name: "Bob", Age: 30, Admin: true}))
+	assert.Equal(t, map[string]interface{}{"name": "Bob", "age": float64(30)}, server.Get("users/bob"))
+
+	require.NoError(t, users.Child("bob").Update(map[string]interface{}{"age": 31}))
+	bob, err = users.Child("bob").Get()
+	require.NoError(t, err)
+	assert.Equal(t, typedUser{Name: "Bob", Age: 31}, bob)
+
+	key, err := users.Push(typedUser{Name: "Alice"})
+	require.NoError(t, err)
+	assert.Len(t, key, 20)
+	assert.Equal(t, map[string]interface{}{"name": "Alice"}, server.Get("users/"+key))
+}
+
+func TestTypedRefRejectsNonObjects(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/bob", "not a user")
+
+	bob, err := NewTypedRef[typedUser](New(server.URL+"/users/bob", nil)).Get()
+	require.Error(t, err)
+	assert.Equal(t, typedUser{}, bob)
+	assert.Contains(t, err.Error(), "/users/bob is a string, not an object")
+
+	// pointers to structs are held to the same standard
+	_, err = NewTypedRef[*typedUser](New(server.URL+"/users/bob", nil)).Get()
+	assert.Error(t, err)
+
+	name, err := NewTypedRef[string](New(server.URL+"/users/bob", nil)).Get()
+	require.NoError(t, err)
+	assert.Equal(t, "not a user", name)
+}
+
+func TestTypedRefWatch(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/bob", map[string]interface{}{"name": "Bob"})
+
+	bob := NewTypedRef[typedUser](New(server.URL+"/users/bob", nil))
+	events := bob.Watch()
+	defer bob.StopWatching()
+
+	next := func() TypedEvent[typedUser] {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("did not receive an event")
+		}
+		return TypedEvent[typedUser]{}
+	}
+
+	e := next()
+	require.NoError(t, e.Err)
+	assert.Equal(t, EventTypePut, e.Type)
+	assert.Equal(t, typedUser{Name: "Bob"}, e.Value)
+
+	server.Set("users/bob/age", 30)
+	e = next()
+	require.NoError(t, e.Err)
+	assert.Equal(t, "/age", e.Path)
+	assert.Equal(t, typedUser{Name: "Bob", Age: 30}, e.Value)
+
+	server.Update("users/bob", map[string]interface{}{"name": "Robert", "age": nil})
+	e = next()
+	require.NoError(t, e.Err)
+	assert.Equal(t, EventTypePatch, e.Type)
+	assert.Equal(t, typedUser{Name: "Robert"}, e.Value)
+
+	server.Set("users/bob", 1)
+	e = next()
+	assert.Error(t, e.Err)
+
+	bob.StopWatching()
+	for range events {
+	}
+}
+
+func TestTypedRefWatchInvalidPath(t *testing.T) {
+	t.Parallel()
+	events := NewTypedRef[typedUser](New(URL, nil).Child("a.b")).Watch()
+
+	e, ok := <-events
+	require.True(t, ok)
+	assert.Equal(t, EventTypeError, e.Type)
+	assert.True(t, errors.Is(e.Err, ErrInvalidPath))
+	_, ok = <-events
+	assert.False(t, ok)
+}
+
+func TestTypedRefChildListeners(t *testing.T) {
+	t.Parallel()
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+	server.Set("users/alice", map[string]interface{}{"name": "Alice"})
+	server.Set("users/bob", "not a user")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	users := NewTypedRef[typedUser](New(server.URL+"/users", nil))
+
+	added := make(chan TypedSnapshot[typedUser], 10)
+	_, err := users.ChildAddedContext(ctx, func(s TypedSnapshot[typedUser], _ string) {
+		added <- s
+	})
+	require.NoError(t, err)
+	changed := make(chan TypedSnapshot[typedUser], 10)
+	_, err = users.ChildChangedContext(ctx, func(s TypedSnapshot[typedUser], _ string) {
+		changed <- s
+	})
+	require.NoError(t, err)
+	removed := make(chan TypedSnapshot[typedUser], 10)
+	_, err = users.ChildRemovedContext(ctx, func(s TypedSnapshot[typedUser], _ string) {
+		removed <- s
+	})
+	require.NoError(t, err)
+
+	next := func(c chan TypedSnapshot[typedUser]) TypedSnapshot[typedUser] {
+		select {
+		case s := <-c:
+			return s
+		case <-time.After(time.Second):
+			t.Fatal("listener was not called")
+		}
+		return TypedSnapshot[typedUser]{}
+	}
+
+	s := next(added)
+	require.NoError(t, s.Err)
+	assert.Equal(t, "alice", s.Key)
+	assert.Equal(t, typedUser{Name: "Alice"}, s.Value)
+	s = next(added)
+	assert.Equal(t, "bob", s.Key)
+	assert.Error(t, s.Err)
+
+	server.Set("users/alice/age", 20)
+	s = next(changed)
+	require.NoError(t, s.Err)
+	assert.Equal(t, typedUser{Name: "Alice", Age: 20}, s.Value)
+
+	server.Delete("users/alice")
+	s = next(removed)
+	require.NoError(t, s.Err)
+	assert.Equal(t, typedUser{Name: "Alice", Age: 20}, s.Value)
+}
@@ -3,11 +3,16 @@ package firego
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/zabawaba99/firego/sync"
 )
 
 const (
@@ -50,6 +55,30 @@ func (e Event) Value(v interface{}) error {
 	return json.Unmarshal(e.rawData, &tmp)
 }
 
+// apply updates db, a local copy of the watched location,
+// with the change the event describes.
+func (e Event) apply(db *sync.Database) {
+	path := strings.Trim(e.Path, "/")
+	switch e.Type {
+	case EventTypePut:
+		if e.Data == nil {
+			db.Del(path)
+			return
+		}
+		db.Add(path, sync.NewNode(path[strings.LastIndex(path, "/")+1:], e.Data))
+	case EventTypePatch:
+		children, _ := e.Data.(map[string]interface{})
+		for k, v := range children {
+			childPath := strings.TrimPrefix(path+"/"+k, "/")
+			if v == nil {
+				db.Del(childPath)
+				continue
+			}
+			db.Add(childPath, sync.NewNode(k, v))
+		}
+	}
+}
+
 // StopWatching stops tears down all connections that are watching.
 func (fb *Firebase) StopWatching() {
 	fb.watchMtx.Lock()
@@ -59,7 +88,7 @@ func (fb *Firebase) StopWatching() {
 		// flip the bit back to not watching
 		fb.watching = false
 		// signal connection to terminal
-		fb.stopWatching <- struct{}{}
+		fb.stopWatching()
 	}
 }
 
@@ -75,36 +104,57 @@ func (fb *Firebase) setWatching(v bool) {
 // Only one connection can be established at a time. The
 // second call to this function without a call to fb.StopWatching
 // will close the channel given and return nil immediately.
+//
+// The channel is closed once the connection is lost, unless the reference
+// has a ReconnectPolicy. In that case an EventTypeDisconnected event is
+// sent instead, followed by an EventTypeReconnected event and the changes
+// made in the meantime once the connection is reestablished.
 func (fb *Firebase) Watch(notifications chan Event) error {
+	return fb.WatchContext(context.Background(), notifications)
+}
+
+// WatchContext is like Watch but the connection is bound to the given
+// context. Once the context is done, an EventTypeError event holding an
+// ErrCanceled or ErrTimeout is sent, the connection is torn down and the
+// channel is closed, after which the reference can be watched again.
+func (fb *Firebase) WatchContext(ctx context.Context, notifications chan Event) error {
 	fb.watchMtx.Lock()
 	if fb.watching {
 		fb.watchMtx.Unlock()
 		close(notifications)
 		return nil
 	}
+	watchCtx, stop := context.WithCancel(ctx)
 	fb.watching = true
+	fb.watchCtx = watchCtx
+	fb.stopWatching = stop
 	fb.watchMtx.Unlock()
 
-	stop := make(chan struct{})
-	events, err := fb.watch(stop)
+	events, err := fb.watch(watchCtx)
 	if err != nil {
+		fb.setWatching(false)
+		stop()
 		return err
 	}
-
-	var closedManually bool
-
-	go func() {
-		<-fb.stopWatching
-		closedManually = true
-		stop <- struct{}{}
-	}()
+	if p := fb.reconnects(); p != nil {
+		events = fb.reconnecting(watchCtx, p, events)
+	}
 
 	go func() {
-		defer close(notifications)
+		defer func() {
+			fb.watchMtx.Lock()
+			if ctx.Err() != nil && fb.watchCtx == watchCtx {
+				// the caller's context ended the connection
+				fb.watching = false
+			}
+			fb.watchMtx.Unlock()
+			close(notifications)
+		}()
 
 		for event := range events {
-			if closedManually {
-				return
+			if watchCtx.Err() != nil && ctx.Err() == nil {
+				// StopWatching was called, drain the remaining events
+				continue
 			}
 
 			notifications <- event
@@ -140,37 +190,68 @@ func readLine(rdr *bufio.Reader, prefix string) ([]byte, error) {
 	return bytes.TrimSpace(line), nil
 }
 
-func (fb *Firebase) watch(stop chan struct{}) (chan Event, error) {
-	// build SSE request
-	req, err := http.NewRequest("GET", fb.String(), nil)
-	if err != nil {
-		fb.setWatching(false)
-		return nil, err
+// openStream opens a connection streaming the changes made to the
+// location, the request is bound to reqCtx while errors are reported
+// according to ctx.
+func (fb *Firebase) openStream(ctx, reqCtx context.Context) (*http.Response, error) {
+	for refreshed := false; ; refreshed = true {
+		// build SSE request
+		req, err := fb.newRequest(reqCtx, "GET", nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Accept", "text/event-stream")
+
+		// do request
+		resp, err := fb.do(req)
+		if err != nil {
+			return nil, requestError(ctx, err)
+		}
+		if resp.StatusCode/200 == 1 {
+			return resp, nil
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, requestError(ctx, err)
+		}
+
+		err = newError(req, resp, body)
+		if refreshed || !fb.refreshToken(err) {
+			return nil, err
+		}
 	}
-	req.Header.Add("Accept", "text/event-stream")
+}
+
+// connect opens a connection of its own streaming the events of the
+// location, which are sent over the returned channel until it closes.
+func (fb *Firebase) connect(ctx context.Context) (chan Event, error) {
+	tokens := fb.tokenCache()
+
+	// the request is canceled when heartbeats stop coming in
+	reqCtx, cancel := context.WithCancel(ctx)
 
-	// do request
-	resp, err := fb.client.Do(req)
+	resp, err := fb.openStream(ctx, reqCtx)
 	if err != nil {
-		fb.setWatching(false)
+		cancel()
 		return nil, err
 	}
 
 	notifications := make(chan Event)
 
-	go func() {
-		<-stop
-		resp.Body.Close()
-	}()
-
 	heartbeat := make(chan struct{})
+	expired := make(chan struct{})
 	go func() {
 		for {
 			select {
 			case <-heartbeat:
 				// do nothing
+			case <-reqCtx.Done():
+				return
 			case <-time.After(fb.watchHeartbeat):
-				resp.Body.Close()
+				close(expired)
+				cancel()
 				return
 			}
 		}
@@ -179,13 +260,22 @@ func (fb *Firebase) watch(stop chan struct{}) (chan Event, error) {
 	// start parsing response body
 	go func() {
 		defer func() {
-			resp.Body.Close()
+			cancel()
+			if resp != nil {
+				resp.Body.Close()
+			}
 			close(notifications)
 		}()
 
 		// build scanner for response body
 		scanner := bufio.NewReader(resp.Body)
 		sendError := func(err error) {
+			select {
+			case <-expired:
+				err = ErrTimeout{fmt.Errorf("no heartbeat received within %s: %s", fb.watchHeartbeat, err)}
+			default:
+				err = requestError(ctx, err)
+			}
 			notifications <- Event{
 				Type: EventTypeError,
 				Data: err,
@@ -253,10 +343,22 @@ func (fb *Firebase) watch(stop chan struct{}) (chan Event, error) {
 			case EventTypeAuthRevoked:
 				// The data for this event is a string indicating that a the credential has expired
 				// This event will be sent when the supplied auth parameter is no longer valid
-				notifications <- event
-				return
+				if tokens == nil {
+					notifications <- event
+					return
+				}
+
+				// reconnect with a new token, which starts
+				// over with the current data of the location
+				tokens.invalidate()
+				resp.Body.Close()
+				if resp, err = fb.openStream(ctx, reqCtx); err != nil {
+					sendError(err)
+					return
+				}
+				scanner = bufio.NewReader(resp.Body)
 			case eventTypeRulesDebug:
-				log.Printf("Rules-Debug: %s\n%s\n", evt, dat)
+				fb.logf("Rules-Debug: %s\n%s\n", evt, dat)
 			}
 		}
 	}()
@@ -1,6 +1,7 @@
 package firego
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -230,3 +231,36 @@ func TestStopWatch(t *testing.T) {
 	_, ok := <-notifications
 	assert.False(t, ok, "notifications should be closed")
 }
+
+func TestWatchContext(t *testing.T) {
+	t.Parallel()
+
+	server := firetest.New()
+	server.Start()
+	defer server.Close()
+
+	fb := New(server.URL, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	notifications := make(chan Event)
+	err := fb.WatchContext(ctx, notifications)
+	require.NoError(t, err)
+
+	<-notifications // get initial notification
+	cancel()
+
+	event, ok := <-notifications
+	require.True(t, ok, "notifications closed")
+	assert.Equal(t, EventTypeError, event.Type)
+	assert.IsType(t, ErrCanceled{}, event.Data)
+
+	_, ok = <-notifications
+	assert.False(t, ok, "notifications should be closed")
+
+	// the reference can be watched again
+	notifications = make(chan Event)
+	require.NoError(t, fb.Watch(notifications))
+	_, ok = <-notifications
+	assert.True(t, ok, "notifications closed")
+	fb.StopWatching()
+}